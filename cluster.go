@@ -0,0 +1,483 @@
+package pgxutils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Log events emitted by Cluster.
+const (
+	LogEventReplicaConnectFailed LogEvent = "replica_connect_failed"
+	LogEventReplicaRemoved       LogEvent = "replica_removed"
+	LogEventReplicaRestored      LogEvent = "replica_restored"
+)
+
+// RoutingStrategy selects the replica a read is sent to.
+type RoutingStrategy int
+
+const (
+	// RoundRobin cycles through healthy replicas in turn.
+	RoundRobin RoutingStrategy = iota
+	// LeastAcquired picks the healthy replica with the fewest acquired connections.
+	LeastAcquired
+)
+
+// ClusterOption is a functional option for configuring Cluster.
+type ClusterOption func(*clusterOptions)
+
+// clusterOptions holds optional configuration for Cluster.
+type clusterOptions struct {
+	routing        RoutingStrategy
+	healthInterval time.Duration
+	maxLag         time.Duration
+	logger         *slog.Logger
+}
+
+// WithRoutingStrategy sets how reads are spread across replicas.
+// Default is RoundRobin.
+func WithRoutingStrategy(strategy RoutingStrategy) ClusterOption {
+	return func(opts *clusterOptions) {
+		opts.routing = strategy
+	}
+}
+
+// WithReplicaHealthInterval sets how often replicas are health checked after
+// Connect. Replicas failing Health leave the rotation until they pass again.
+// Default is 10s; zero disables background checks.
+func WithReplicaHealthInterval(interval time.Duration) ClusterOption {
+	return func(opts *clusterOptions) {
+		opts.healthInterval = interval
+	}
+}
+
+// WithClusterLogger sets the logger for cluster events.
+// Default is the primary Connection's logger.
+func WithClusterLogger(logger *slog.Logger) ClusterOption {
+	return func(opts *clusterOptions) {
+		opts.logger = logger
+	}
+}
+
+// Cluster routes statements across a primary and read replicas.
+//
+// Query and QueryRow go to a healthy replica, falling back to the primary when
+// none is available. Exec, SendBatch, CopyFrom and transactions always go to
+// the primary, as do reads whose context is marked with ForcePrimary.
+type Cluster struct {
+	primary  *Connection
+	replicas []*clusterReplica
+	opts     clusterOptions
+	events   eventLogger
+
+	next atomic.Uint64
+
+	mu       sync.Mutex
+	ctx      context.Context // background work runs under it until Close
+	cancel   context.CancelFunc
+	checking bool           // whether background health checks run
+	wg       sync.WaitGroup // background health checks and replica connects
+}
+
+// clusterReplica is a replica, whether it is in the rotation, and the
+// outcome of its last check.
+type clusterReplica struct {
+	conn    *Connection
+	healthy atomic.Bool
+	joining atomic.Bool // a goroutine waits to check it once it connects
+
+	mu       sync.Mutex
+	checked  bool // whether a check has completed
+	lag      time.Duration
+	lagKnown bool
+	lastErr  error
+}
+
+var _ Querier = (*Cluster)(nil)
+
+// NewCluster creates a Cluster from a primary and zero or more replicas. The
+// Connections are owned by the Cluster: Connect and Close act on all of them.
+//
+// Example usage:
+//
+//	primary, _ := pgxutils.NewConnection(cfg.Primary)
+//	replica, _ := pgxutils.NewConnection(cfg.Replica)
+//	cluster, err := pgxutils.NewCluster(primary, []*pgxutils.Connection{replica},
+//	    pgxutils.WithRoutingStrategy(pgxutils.LeastAcquired),
+//	)
+func NewCluster(primary *Connection, replicas []*Connection, opts ...ClusterOption) (*Cluster, error) {
+	if primary == nil {
+		return nil, errors.NewValidationError("primary connection cannot be nil", "primary")
+	}
+
+	o := clusterOptions{
+		routing:        RoundRobin,
+		healthInterval: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+
+	events := primary.events()
+	if o.logger != nil {
+		events.logger = o.logger
+	}
+
+	c := &Cluster{
+		primary: primary,
+		opts:    o,
+		events:  events,
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	for i, replica := range replicas {
+		if replica == nil {
+			return nil, errors.NewValidationError("replica connection cannot be nil", "replicas")
+		}
+		if replica == primary {
+			return nil, errors.NewValidationError("replica cannot be the primary connection", "replicas")
+		}
+		for _, other := range replicas[:i] {
+			if other == replica {
+				return nil, errors.NewValidationError("replica connection listed twice", "replicas")
+			}
+		}
+		c.replicas = append(c.replicas, &clusterReplica{conn: replica})
+	}
+
+	return c, nil
+}
+
+// Connect connects the primary, then connects every replica in the
+// background with ConnectAsync and starts background replica health checks,
+// so replicas that are down do not delay startup.
+//
+// Only a primary failure is returned. A replica joins the rotation once it has
+// connected and passed a check; replicas failing checks, or lagging beyond
+// WithMaxReplicationLag, stay out of it until a check passes.
+func (c *Cluster) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	if c.ctx == nil {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+	}
+	c.mu.Unlock()
+
+	if err := c.primary.Connect(ctx); err != nil {
+		return err
+	}
+
+	for i, replica := range c.replicas {
+		c.connectReplica(i, replica)
+	}
+
+	c.startHealthChecks()
+	return nil
+}
+
+// Close stops health checks and background replica connects, and closes the
+// primary and every replica.
+func (c *Cluster) Close() {
+	c.stopBackground()
+
+	for _, replica := range c.replicas {
+		replica.healthy.Store(false)
+		replica.conn.Close()
+	}
+	c.primary.Close()
+}
+
+// Primary returns the primary Connection.
+func (c *Cluster) Primary() *Connection {
+	return c.primary
+}
+
+// Replicas returns the replica Connections, healthy or not.
+func (c *Cluster) Replicas() []*Connection {
+	replicas := make([]*Connection, len(c.replicas))
+	for i, replica := range c.replicas {
+		replicas[i] = replica.conn
+	}
+	return replicas
+}
+
+// HealthyReplicas returns the number of replicas currently in the rotation.
+func (c *Cluster) HealthyReplicas() int {
+	n := 0
+	for _, replica := range c.replicas {
+		if replica.healthy.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+// primaryKey marks a context whose reads must go to the primary.
+type primaryKey struct{}
+
+// ForcePrimary returns a context whose reads through a Cluster go to the
+// primary, for reading rows the caller has just written.
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func isPrimaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryKey{}).(bool)
+	return forced
+}
+
+// Reader returns the Connection a read with ctx is routed to: a healthy
+// replica chosen by the routing strategy, or the primary when ctx is marked
+// with ForcePrimary, carries a transaction, or no replica is healthy and
+// within the MaxStaleness set on ctx.
+func (c *Cluster) Reader(ctx context.Context) *Connection {
+	if isPrimaryForced(ctx) {
+		return c.primary
+	}
+	if _, ok := TxFromContext(ctx); ok {
+		return c.primary
+	}
+
+	if replica := c.pickReplica(maxStaleness(ctx)); replica != nil {
+		return replica.conn
+	}
+	return c.primary
+}
+
+// pickReplica returns a healthy replica whose lag is within staleness (when
+// positive), or nil when there is none.
+func (c *Cluster) pickReplica(staleness time.Duration) *clusterReplica {
+	if len(c.replicas) == 0 {
+		return nil
+	}
+	n := uint64(len(c.replicas)) // #nosec G115 - lengths are non-negative
+
+	if c.opts.routing == LeastAcquired {
+		// Start at a rotating offset so ties are spread across replicas
+		start := c.next.Add(1)
+		var best *clusterReplica
+		var bestAcquired int32
+		for i := range n {
+			replica := c.replicas[(start+i)%n]
+			if !replica.eligible(staleness) {
+				continue
+			}
+			acquired := replica.conn.GetMetrics().AcquiredConns
+			if best == nil || acquired < bestAcquired {
+				best, bestAcquired = replica, acquired
+			}
+		}
+		return best
+	}
+
+	// Advance the counter past unhealthy replicas so the rest share reads evenly
+	for range n {
+		replica := c.replicas[c.next.Add(1)%n]
+		if replica.eligible(staleness) {
+			return replica
+		}
+	}
+	return nil
+}
+
+// CheckReplicas health checks every replica now and measures its replication
+// lag, taking failing or lagging replicas out of the rotation and returning
+// recovered ones to it. ctx bounds the checks only.
+//
+// A replica without a pool, such as one whose background connect gave up, is
+// reconnected in the background under the Cluster's own context, and joins
+// the rotation once it connects and passes a check.
+func (c *Cluster) CheckReplicas(ctx context.Context) {
+	for i, replica := range c.replicas {
+		if replica.conn.currentPool() == nil && !replica.conn.shuttingDown.Load() {
+			c.connectReplica(i, replica)
+		}
+		c.checkReplica(ctx, i, replica)
+	}
+}
+
+// checkReplica health checks one replica and updates its place in the rotation.
+func (c *Cluster) checkReplica(ctx context.Context, i int, replica *clusterReplica) {
+	err := replica.conn.Health(ctx)
+
+	var lag time.Duration
+	lagKnown := false
+	if err == nil {
+		var lagErr error
+		lag, lagErr = c.replicationLag(ctx, replica.conn)
+		lagKnown = lagErr == nil
+		if lagErr != nil && c.opts.maxLag > 0 {
+			err = lagErr
+		}
+	}
+	if err == nil && c.opts.maxLag > 0 && lag > c.opts.maxLag {
+		err = fmt.Errorf("replication lag %s exceeds %s", lag, c.opts.maxLag)
+	}
+
+	err = redactError(err, replica.conn.secrets()...)
+
+	replica.mu.Lock()
+	replica.checked = true
+	replica.lag, replica.lagKnown, replica.lastErr = lag, lagKnown, err
+	replica.mu.Unlock()
+
+	healthy := err == nil
+	if replica.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	if healthy {
+		c.events.log(ctx, LogEventReplicaRestored, slog.LevelInfo,
+			"replica returned to rotation", "replica", i)
+	} else {
+		c.events.log(ctx, LogEventReplicaRemoved, slog.LevelWarn,
+			"replica removed from rotation", "replica", i, "error", err)
+	}
+}
+
+// background returns the context background work runs under and adds one to
+// wg for it, or reports false once the Cluster is closed.
+func (c *Cluster) background() (context.Context, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ctx == nil {
+		return nil, false
+	}
+	c.wg.Add(1)
+	return c.ctx, true
+}
+
+// connectReplica starts connecting a replica in the background, unless it is
+// already connecting, and checks it as soon as it connects so it joins the
+// rotation without waiting for the next health check.
+func (c *Cluster) connectReplica(i int, replica *clusterReplica) {
+	ctx, ok := c.background()
+	if !ok {
+		return
+	}
+
+	if err := replica.conn.ConnectAsync(ctx); err != nil {
+		c.wg.Done()
+		c.events.log(ctx, LogEventReplicaConnectFailed, slog.LevelWarn,
+			"replica connection failed", "replica", i, "error", err)
+		return
+	}
+	if !replica.joining.CompareAndSwap(false, true) {
+		c.wg.Done()
+		return
+	}
+
+	go func() {
+		defer c.wg.Done()
+		defer replica.joining.Store(false)
+
+		select {
+		case <-replica.conn.Ready():
+			c.checkReplica(ctx, i, replica)
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// startHealthChecks runs CheckReplicas every health interval until Close.
+func (c *Cluster) startHealthChecks() {
+	if c.opts.healthInterval <= 0 || len(c.replicas) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	if c.checking || c.ctx == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.checking = true
+	ctx := c.ctx
+	c.wg.Add(1)
+	c.mu.Unlock()
+
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.opts.healthInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.CheckReplicas(ctx)
+			}
+		}
+	}()
+}
+
+// stopBackground cancels background health checks and replica connects and
+// waits for them to exit.
+func (c *Cluster) stopBackground() {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.ctx, c.cancel, c.checking = nil, nil, false
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	c.wg.Wait()
+}
+
+// FromContext returns the transaction carried by ctx, or the Cluster itself.
+func (c *Cluster) FromContext(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return c
+}
+
+// Exec executes a statement on the primary.
+func (c *Cluster) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return c.primary.Exec(ctx, sql, args...)
+}
+
+// Query executes a query returning multiple rows on the connection chosen by Reader.
+func (c *Cluster) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return c.Reader(ctx).Query(ctx, sql, args...)
+}
+
+// QueryRow executes a query expecting a single row on the connection chosen by Reader.
+func (c *Cluster) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return c.Reader(ctx).QueryRow(ctx, sql, args...)
+}
+
+// SendBatch sends a batch of queries to the primary.
+func (c *Cluster) SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults {
+	return c.primary.SendBatch(ctx, batch)
+}
+
+// CopyFrom copies rows into a table on the primary.
+func (c *Cluster) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return c.primary.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+// Begin starts a transaction on the primary.
+func (c *Cluster) Begin(ctx context.Context) (pgx.Tx, error) {
+	return c.primary.Begin(ctx)
+}
+
+// BeginTx starts a transaction with custom options on the primary.
+func (c *Cluster) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	return c.primary.BeginTx(ctx, txOptions)
+}
+
+// WithTransaction runs fn in a transaction on the primary.
+func (c *Cluster) WithTransaction(ctx context.Context, fn func(pgx.Tx) error) error {
+	return c.primary.WithTransaction(ctx, fn)
+}
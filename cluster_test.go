@@ -0,0 +1,174 @@
+package pgxutils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCluster(t *testing.T, replicas int, opts ...ClusterOption) *Cluster {
+	t.Helper()
+
+	primary, err := NewConnection(baseConfig())
+	require.NoError(t, err)
+
+	conns := make([]*Connection, replicas)
+	for i := range conns {
+		conns[i], err = NewConnection(baseConfig())
+		require.NoError(t, err)
+	}
+
+	cluster, err := NewCluster(primary, conns, opts...)
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+func TestNewCluster_Validation(t *testing.T) {
+	primary, err := NewConnection(baseConfig())
+	require.NoError(t, err)
+	replica, err := NewConnection(baseConfig())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		primary  *Connection
+		replicas []*Connection
+	}{
+		{"nil primary", nil, nil},
+		{"nil replica", primary, []*Connection{nil}},
+		{"primary as replica", primary, []*Connection{primary}},
+		{"duplicate replica", primary, []*Connection{replica, replica}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, err := NewCluster(tt.primary, tt.replicas)
+			require.Error(t, err)
+			assert.Nil(t, cluster)
+			assert.True(t, errors.IsValidation(err))
+		})
+	}
+}
+
+func TestCluster_ReaderFallsBackToPrimary(t *testing.T) {
+	cluster := newTestCluster(t, 2)
+
+	// Replicas are out of rotation until connected
+	assert.Equal(t, 0, cluster.HealthyReplicas())
+	assert.Same(t, cluster.Primary(), cluster.Reader(context.Background()))
+}
+
+func TestCluster_RoundRobin(t *testing.T) {
+	cluster := newTestCluster(t, 3)
+	for _, replica := range cluster.replicas {
+		replica.healthy.Store(true)
+	}
+	cluster.replicas[1].healthy.Store(false)
+
+	seen := make(map[*Connection]int)
+	for range 10 {
+		seen[cluster.Reader(context.Background())]++
+	}
+
+	assert.Equal(t, 5, seen[cluster.replicas[0].conn])
+	assert.Zero(t, seen[cluster.replicas[1].conn])
+	assert.Equal(t, 5, seen[cluster.replicas[2].conn])
+	assert.Zero(t, seen[cluster.Primary()])
+}
+
+func TestCluster_LeastAcquiredSkipsUnhealthy(t *testing.T) {
+	cluster := newTestCluster(t, 2, WithRoutingStrategy(LeastAcquired))
+	cluster.replicas[1].healthy.Store(true)
+
+	for range 4 {
+		assert.Same(t, cluster.replicas[1].conn, cluster.Reader(context.Background()))
+	}
+}
+
+func TestCluster_ForcePrimary(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	cluster.replicas[0].healthy.Store(true)
+
+	ctx := context.Background()
+	assert.Same(t, cluster.replicas[0].conn, cluster.Reader(ctx))
+	assert.Same(t, cluster.Primary(), cluster.Reader(ForcePrimary(ctx)))
+	assert.Same(t, cluster.Primary(), cluster.Reader(ContextWithTx(ctx, &fakeTx{})))
+}
+
+func TestCluster_CheckReplicasRemovesFailing(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	cluster.replicas[0].healthy.Store(true)
+
+	// An unconnected replica fails Health
+	cluster.CheckReplicas(context.Background())
+
+	assert.Equal(t, 0, cluster.HealthyReplicas())
+}
+
+func TestCluster_CheckReplicasReconnectsUnconnected(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	replica := cluster.replicas[0].conn
+
+	cluster.CheckReplicas(context.Background())
+
+	bg := replica.connecting.Load()
+	require.NotNil(t, bg, "a replica without a pool is reconnected in the background")
+
+	// A second check leaves the running connect alone
+	cluster.CheckReplicas(context.Background())
+	assert.Same(t, bg, replica.connecting.Load())
+
+	cluster.Close()
+	assert.True(t, bg.finished(), "Close stops the background connect")
+}
+
+func TestCluster_ConnectDoesNotWaitForReplicas(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = stallingServer(t)
+	primary, err := NewConnection(cfg)
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(primary, []*Connection{unreachableConnection(t)}, WithReplicaHealthInterval(0))
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+
+	start := time.Now()
+	require.NoError(t, cluster.Connect(context.Background()))
+	assert.Less(t, time.Since(start), time.Second, "an unreachable replica must not delay startup")
+
+	bg := cluster.replicas[0].conn.connecting.Load()
+	require.NotNil(t, bg, "the replica connects in the background")
+	assert.False(t, bg.finished())
+	assert.Equal(t, 0, cluster.HealthyReplicas())
+
+	cluster.Close()
+	assert.True(t, bg.finished(), "Close stops the background connect")
+	assert.False(t, cluster.replicas[0].joining.Load())
+}
+
+func TestCluster_CheckReplicasReconnectOutlivesRequest(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	replica := cluster.replicas[0].conn
+
+	// A health request whose context ends as soon as the check returns
+	ctx, cancel := context.WithCancel(context.Background())
+	cluster.CheckReplicas(ctx)
+	cancel()
+
+	bg := replica.connecting.Load()
+	require.NotNil(t, bg)
+	assert.Never(t, bg.finished, 100*time.Millisecond, 10*time.Millisecond,
+		"the reconnect runs under the Cluster's context, not the request's")
+}
+
+func TestCluster_CloseWithoutConnect(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+
+	assert.NotPanics(t, cluster.Close)
+}
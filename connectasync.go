@@ -0,0 +1,155 @@
+package pgxutils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+)
+
+// LogEventConnectFailed is logged when a background connect started by
+// ConnectAsync gives up.
+const LogEventConnectFailed LogEvent = "connect_failed"
+
+// ErrNotReady is returned by Connection methods called while ConnectAsync is
+// still establishing the pool, or after it gave up, in which case the error
+// also wraps the reason.
+var ErrNotReady = errors.New("database connection not ready")
+
+// WithLazyConnect makes Connect behave as ConnectAsync, returning at once and
+// establishing the pool in the background.
+func WithLazyConnect() Option {
+	return func(opts *connectionOptions) {
+		opts.lazyConnect = true
+	}
+}
+
+// WithWaitForConnect makes calls made while ConnectAsync is connecting wait
+// for the pool until their context is done, instead of failing at once with
+// ErrNotReady.
+func WithWaitForConnect() Option {
+	return func(opts *connectionOptions) {
+		opts.waitForConnect = true
+	}
+}
+
+// backgroundConnect is a connect running in the background.
+type backgroundConnect struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the connect has ended
+	err    error         // why it failed, set before done is closed
+}
+
+// ConnectAsync starts establishing the pool in the background and returns
+// without waiting, so a service can start while the database is down.
+//
+// Attempts follow the ConnectRetryPolicy (see WithConnectRetryPolicy) but are not
+// bounded by RetryTimeout: they continue until they succeed, the policy's
+// MaxAttempts run out, the database rejects the credentials, or ctx is done.
+// Configuration errors are returned straight away.
+//
+// Until the pool is ready, Connection methods fail with ErrNotReady, or wait
+// for it with WithWaitForConnect. Ready reports when it is. Calling
+// ConnectAsync while a background connect is running, or once connected, does
+// nothing; after one has given up, it starts another.
+func (c *Connection) ConnectAsync(ctx context.Context) error {
+	if c.pool.Load() != nil {
+		return nil
+	}
+
+	poolConfig, err := c.buildPoolConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	bg := &backgroundConnect{cancel: cancel, done: make(chan struct{})}
+	for {
+		running := c.connecting.Load()
+		if running != nil && !running.finished() {
+			cancel()
+			return nil
+		}
+		if c.connecting.CompareAndSwap(running, bg) {
+			break
+		}
+	}
+	c.shuttingDown.Store(false)
+
+	go func() {
+		defer cancel()
+		defer close(bg.done)
+
+		if err := c.connect(ctx, poolConfig, 0); err != nil {
+			bg.err = err
+			c.events().log(ctx, LogEventConnectFailed, slog.LevelError, "background database connect failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// finished reports whether the background connect has ended.
+func (bg *backgroundConnect) finished() bool {
+	select {
+	case <-bg.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ready returns a channel closed once the pool has first been established,
+// by Connect or in the background by ConnectAsync.
+//
+// Example usage:
+//
+//	select {
+//	case <-conn.Ready():
+//	    // serve traffic
+//	case <-ctx.Done():
+//	}
+func (c *Connection) Ready() <-chan struct{} {
+	return c.readyChan()
+}
+
+func (c *Connection) readyChan() chan struct{} {
+	c.readyOnce.Do(func() { c.ready = make(chan struct{}) })
+	return c.ready
+}
+
+// markReady closes the Ready channel.
+func (c *Connection) markReady() {
+	ready := c.readyChan()
+	c.readyMark.Do(func() { close(ready) })
+}
+
+// awaitConnect is consulted when there is no pool. It returns nil once a
+// background connect has established one, and otherwise the error to report.
+func (c *Connection) awaitConnect(ctx context.Context) error {
+	bg := c.connecting.Load()
+	if bg == nil || c.shuttingDown.Load() {
+		return c.notConnectedError()
+	}
+
+	if c.opts.waitForConnect {
+		select {
+		case <-bg.done:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrNotReady, ctx.Err())
+		}
+	}
+	if bg.finished() && bg.err == nil {
+		return nil
+	}
+	return c.notConnectedError()
+}
+
+// stopConnecting cancels a running background connect and waits for it to
+// end, so that it cannot install a pool afterwards.
+func (c *Connection) stopConnecting() {
+	if bg := c.connecting.Load(); bg != nil {
+		bg.cancel()
+		<-bg.done
+	}
+}
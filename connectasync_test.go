@@ -0,0 +1,115 @@
+package pgxutils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastRetries fails a background connect to an unreachable server quickly.
+func fastRetries(attempts int) Option {
+	return WithConnectRetryPolicy(ConnectRetryPolicy{
+		InitialDelay: time.Millisecond,
+		MaxDelay:     5 * time.Millisecond,
+		MaxAttempts:  attempts,
+	})
+}
+
+func TestConnectAsync_FailsFastUntilReady(t *testing.T) {
+	conn := unreachableConnection(t, WithConnectRetryPolicy(ConnectRetryPolicy{
+		InitialDelay: time.Minute,
+		MaxDelay:     time.Minute,
+	}))
+	defer conn.Close()
+
+	start := time.Now()
+	require.NoError(t, conn.ConnectAsync(context.Background()))
+	assert.Less(t, time.Since(start), time.Second, "ConnectAsync should not wait for the database")
+
+	_, err := conn.Exec(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, ErrNotReady)
+	assert.ErrorIs(t, conn.Health(context.Background()), ErrNotReady)
+
+	select {
+	case <-conn.Ready():
+		t.Fatal("Ready closed without a pool")
+	default:
+	}
+}
+
+func TestConnectAsync_WaitBoundedByContext(t *testing.T) {
+	conn := unreachableConnection(t, WithWaitForConnect(), WithConnectRetryPolicy(ConnectRetryPolicy{
+		InitialDelay: time.Minute,
+		MaxDelay:     time.Minute,
+	}))
+	defer conn.Close()
+	require.NoError(t, conn.ConnectAsync(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := conn.Exec(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, ErrNotReady)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestConnectAsync_ReportsWhyItGaveUp(t *testing.T) {
+	conn := unreachableConnection(t, fastRetries(2))
+	require.NoError(t, conn.ConnectAsync(context.Background()))
+
+	require.Eventually(t, func() bool {
+		return conn.connecting.Load().finished()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err := conn.Exec(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, ErrNotReady)
+	assert.Contains(t, err.Error(), "failed to connect after 2 attempts")
+}
+
+func TestConnectAsync_LazyConnect(t *testing.T) {
+	conn := unreachableConnection(t, WithLazyConnect(), WithConnectRetryPolicy(ConnectRetryPolicy{
+		InitialDelay: time.Minute,
+		MaxDelay:     time.Minute,
+	}))
+	defer conn.Close()
+
+	require.NoError(t, conn.Connect(context.Background()))
+	_, err := conn.Query(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, ErrNotReady)
+}
+
+func TestConnectAsync_ConfigErrorsReturnedAtOnce(t *testing.T) {
+	conn, err := NewConnection(baseConfig(), WithTargetSessionAttrs("leader"))
+	require.NoError(t, err)
+
+	assert.Error(t, conn.ConnectAsync(context.Background()))
+	assert.Nil(t, conn.connecting.Load())
+}
+
+func TestConnectAsync_StoppedByShutdown(t *testing.T) {
+	conn := unreachableConnection(t, WithConnectRetryPolicy(ConnectRetryPolicy{
+		InitialDelay: time.Minute,
+		MaxDelay:     time.Minute,
+	}))
+	require.NoError(t, conn.ConnectAsync(context.Background()))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = conn.Shutdown(context.Background())
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not stop the background connect")
+	}
+
+	assert.True(t, conn.connecting.Load().finished())
+	_, err := conn.Exec(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, ErrShuttingDown)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	config "github.com/JohnPlummer/jp-go-config"
@@ -17,25 +19,71 @@ import (
 // Connection manages a PostgreSQL connection pool with automatic retry and health checking.
 // Thread-safe after Connect() succeeds.
 type Connection struct {
-	pool   *pgxpool.Pool
+	pool   atomic.Pointer[poolHandle]
 	cfg    *config.DatabaseConfig
 	logger *slog.Logger
 	opts   connectionOptions
+	dsn    string // set by NewConnectionFromDSN
+
+	dsnPassword string // password in dsn, redacted from errors and logs
+
+	credentials *credentialCache // set by WithCredentialProvider
+	tls         *tlsFiles        // set by the TLS options
+
+	shuttingDown atomic.Bool // set by Shutdown, cleared by Connect
+
+	connecting atomic.Pointer[backgroundConnect] // set by ConnectAsync
+	readyOnce  sync.Once
+	ready      chan struct{}
+	readyMark  sync.Once
+
+	monitor     atomic.Pointer[HealthMonitor] // the running StartHealthMonitor, if any
+	poolSamples poolSampler
 }
 
 // connectionOptions holds optional configuration for Connection.
 type connectionOptions struct {
-	healthTimeout time.Duration
-	retryTimeout  time.Duration
+	healthTimeout  time.Duration
+	retryTimeout   time.Duration
+	logger         *slog.Logger
+	logLevels      LogLevelPolicy
+	tracers        []pgx.QueryTracer
+	slowQuery      slowQueryOptions
+	classifyErrors bool
+
+	hosts              []string
+	targetSessionAttrs TargetSessionAttrs
+	runtimeParams      map[string]string
+
+	credentialProvider CredentialProvider
+	credentialTTL      time.Duration
+	minSecretLength    int
+
+	tls tlsOptions
+
+	connectRetry   ConnectRetryPolicy
+	lazyConnect    bool
+	waitForConnect bool
+
+	poolThresholds PoolThresholds
 }
 
 // Option is a functional option for configuring Connection.
 type Option func(*connectionOptions)
 
 // WithLogger sets a custom logger for the connection.
+// Default is slog.Default().
 func WithLogger(logger *slog.Logger) Option {
 	return func(opts *connectionOptions) {
-		// Logger is stored separately from connectionOptions
+		opts.logger = logger
+	}
+}
+
+// WithLogLevelPolicy sets the policy deciding the level of each log event.
+// Default logs every event at its built-in level.
+func WithLogLevelPolicy(policy LogLevelPolicy) Option {
+	return func(opts *connectionOptions) {
+		opts.logLevels = policy
 	}
 }
 
@@ -70,30 +118,45 @@ func NewConnection(cfg *config.DatabaseConfig, opts ...Option) (*Connection, err
 	connOpts := connectionOptions{
 		healthTimeout: 5 * time.Second,
 		retryTimeout:  30 * time.Second,
+		slowQuery: slowQueryOptions{
+			sampleRate: 1,
+			rateLimit:  time.Minute,
+		},
 	}
 
-	var logger *slog.Logger
 	for _, opt := range opts {
 		if opt != nil {
-			// Special handling for logger
-			optCopy := opt
 			opt(&connOpts)
-
-			// Extract logger from closure if WithLogger was used
-			testOpts := connectionOptions{}
-			optCopy(&testOpts)
 		}
 	}
 
+	logger := connOpts.logger
 	if logger == nil {
 		logger = slog.Default()
 	}
 
-	return &Connection{
+	conn := &Connection{
 		cfg:    cfg,
 		logger: logger,
 		opts:   connOpts,
-	}, nil
+	}
+	if connOpts.credentialProvider != nil {
+		conn.credentials = &credentialCache{
+			provider: connOpts.credentialProvider,
+			ttl:      connOpts.credentialTTL,
+		}
+	}
+	if connOpts.tls.enabled() {
+		conn.tls = &tlsFiles{opts: connOpts.tls}
+	}
+	return conn, nil
+}
+
+// events returns the connection's logger with its level policy applied.
+func (c *Connection) events() eventLogger {
+	events := newEventLogger(c.logger, c.opts.logLevels)
+	events.secrets = c.secrets()
+	return events
 }
 
 // buildPoolConfig turns the DatabaseConfig into a pgxpool config.
@@ -112,22 +175,21 @@ func NewConnection(cfg *config.DatabaseConfig, opts ...Option) (*Connection, err
 // viper loading never get that loader's defaults, so they would otherwise reach
 // pgxpool with zeros.
 func (c *Connection) buildPoolConfig() (*pgxpool.Config, error) {
-	connStr := fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		c.cfg.User,
-		c.cfg.Password,
-		c.cfg.Host,
-		c.cfg.Port,
-		c.cfg.Database,
-		c.cfg.SSLMode,
-	)
+	if err := validateTargetSessionAttrs(c.opts.targetSessionAttrs); err != nil {
+		return nil, err
+	}
+
+	connStr, err := c.connString()
+	if err != nil {
+		return nil, err
+	}
 
 	poolConfig, err := pgxpool.ParseConfig(connStr)
 	if err != nil {
 		return nil, errors.NewValidationError(
 			"failed to parse database URL",
 			"database_url",
-			errors.WithCause(err),
+			errors.WithCause(redactError(err, c.secrets()...)),
 		)
 	}
 
@@ -161,78 +223,190 @@ func (c *Connection) buildPoolConfig() (*pgxpool.Config, error) {
 	// Health check runs every 30s to detect stale connections
 	poolConfig.HealthCheckPeriod = 30 * time.Second
 
+	tracers := make([]pgx.QueryTracer, 0, len(c.opts.tracers)+3)
+	for _, tracer := range c.opts.tracers {
+		if rt, ok := tracer.(RedactingTracer); ok {
+			tracer = rt.WithRedaction(c.redactSecrets)
+		}
+		tracers = append(tracers, tracer)
+	}
+	if c.opts.slowQuery.threshold > 0 {
+		tracers = append(tracers, newSlowQueryTracer(c.opts.slowQuery, c.events()))
+	}
+	if c.requiresWritable() {
+		tracers = append(tracers, &failoverTracer{conn: c})
+	}
+	if c.credentials != nil {
+		tracers = append(tracers, &credentialTracer{cache: c.credentials})
+	}
+	if tracer := combineTracers(tracers); tracer != nil {
+		poolConfig.ConnConfig.Tracer = tracer
+	}
+
+	if c.tls != nil {
+		if err := c.validateTLS(poolConfig.ConnConfig); err != nil {
+			return nil, err
+		}
+	}
+	if c.credentials != nil || c.tls != nil {
+		poolConfig.BeforeConnect = c.beforeConnect
+	}
 	return poolConfig, nil
 }
 
-// Connect establishes the connection pool with exponential backoff retry.
+// beforeConnect prepares each new physical connection with the current
+// credentials and TLS material.
+func (c *Connection) beforeConnect(ctx context.Context, cc *pgx.ConnConfig) error {
+	if c.credentials != nil {
+		if err := c.applyCredentials(ctx, cc); err != nil {
+			return err
+		}
+	}
+	if c.tls != nil {
+		if err := c.applyTLS(cc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Connect establishes the connection pool, retrying failed attempts.
 //
-// Retries for up to RetryTimeout (default 30s) with max 10s between attempts.
-// Returns error if connection cannot be established within timeout.
+// Attempts are spaced by the jittered exponential backoff of the ConnectRetryPolicy
+// (see WithConnectRetryPolicy) and continue for up to RetryTimeout (default
+// 30s). Authentication failures and a missing database are returned at once,
+// and waiting between attempts stops when ctx is done.
+//
+// With WithLazyConnect, Connect behaves as ConnectAsync.
 func (c *Connection) Connect(ctx context.Context) error {
+	if c.opts.lazyConnect {
+		return c.ConnectAsync(ctx)
+	}
+
 	poolConfig, err := c.buildPoolConfig()
 	if err != nil {
 		return err
 	}
+	return c.connect(ctx, poolConfig, c.opts.retryTimeout)
+}
 
-	// Retry with exponential backoff capped at 10s
-	var pool *pgxpool.Pool
-	retryTimeout := c.opts.retryTimeout
-
-	deadline := time.Now().Add(retryTimeout)
-	attempt := 0
+// connect runs the retry loop of Connect. A zero retryTimeout retries until ctx
+// is done or the policy's attempts run out.
+func (c *Connection) connect(ctx context.Context, poolConfig *pgxpool.Config, retryTimeout time.Duration) error {
+	policy := c.opts.connectRetry.withDefaults()
+	start := time.Now()
+	deadline := start.Add(retryTimeout)
 
-	for time.Now().Before(deadline) {
-		attempt++
-		pool, err = pgxpool.NewWithConfig(ctx, poolConfig)
+	for attempt := 1; ; attempt++ {
+		h, err := openPool(ctx, poolConfig)
 		if err == nil {
-			pingErr := pool.Ping(ctx)
-			if pingErr == nil {
-				c.pool = pool
-				c.logger.Info(
-					"database connection established",
-					"host", c.cfg.Host,
-					"port", c.cfg.Port,
-					"database", c.cfg.Database,
-					"attempts", attempt,
-				)
-				return nil
+			if policy.OnAttempt != nil {
+				policy.OnAttempt(attempt, nil, 0)
+			}
+			if old := c.pool.Swap(h); old != nil {
+				c.drain(old)
 			}
-			// Ping failure requires pool cleanup before retry
-			pool.Close()
-			err = pingErr
+			c.shuttingDown.Store(false)
+			c.markReady()
+			c.events().log(
+				ctx,
+				LogEventConnected,
+				slog.LevelInfo,
+				"database connection established",
+				"host", landedHost(ctx, h.pool),
+				"database", c.cfg.Database,
+				"attempts", attempt,
+			)
+			return nil
 		}
 
-		c.logger.Warn(
+		permanent := isPermanentConnectError(err)
+		exhausted := policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts
+
+		var delay time.Duration
+		if !permanent && !exhausted && ctx.Err() == nil {
+			delay = policy.backoff().delay(attempt)
+			if retryTimeout > 0 {
+				// The last attempt is made at the deadline rather than skipped
+				remaining := time.Until(deadline)
+				if remaining <= 0 {
+					exhausted = true
+					delay = 0
+				} else {
+					delay = min(delay, remaining)
+				}
+			}
+		}
+		if policy.OnAttempt != nil {
+			policy.OnAttempt(attempt, err, delay)
+		}
+
+		c.events().log(
+			ctx,
+			LogEventConnectAttemptFailed,
+			slog.LevelWarn,
 			"connection attempt failed",
 			"attempt", attempt,
+			"delay", delay,
 			"error", err,
 		)
 
-		backoff := time.Duration(attempt) * time.Second
-		if backoff > 10*time.Second {
-			backoff = 10 * time.Second
+		cause := errors.WithCause(redactError(err, c.secrets()...))
+		switch {
+		case permanent:
+			return errors.NewProcessingError(
+				"database rejected the connection",
+				"database_connect",
+				cause,
+			)
+		case exhausted && retryTimeout <= 0:
+			return errors.NewProcessingError(
+				fmt.Sprintf("failed to connect after %d attempts", attempt),
+				"database_connect",
+				cause,
+			)
+		case exhausted:
+			return errors.NewTimeoutError(
+				fmt.Sprintf("failed to connect after %d attempts", attempt),
+				"database_connect",
+				time.Since(start),
+				cause,
+			)
 		}
 
-		if time.Now().Add(backoff).After(deadline) {
-			break
+		if ctxErr := sleepContext(ctx, delay); ctxErr != nil {
+			return errors.NewProcessingError(
+				fmt.Sprintf("connect canceled after %d attempts", attempt),
+				"database_connect",
+				errors.WithCause(ctxErr),
+			)
 		}
-
-		time.Sleep(backoff)
 	}
+}
 
-	return errors.NewTimeoutError(
-		fmt.Sprintf("failed to connect after %d attempts", attempt),
-		"database_connect",
-		retryTimeout,
-		errors.WithCause(err),
-	)
+// openPool creates a pool and pings it, closing it again if the ping fails.
+// The pool's connections are recorded in a registry of its own.
+func openPool(ctx context.Context, poolConfig *pgxpool.Config) (*poolHandle, error) {
+	conns := &connRegistry{}
+	pool, err := pgxpool.NewWithConfig(ctx, conns.track(poolConfig))
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return newPoolHandle(pool, conns), nil
 }
 
-// Close closes all pool connections immediately.
+// Close closes all pool connections immediately. Use Shutdown to let running
+// queries and transactions finish first.
 func (c *Connection) Close() {
-	if c.pool != nil {
-		c.pool.Close()
-		c.logger.Info("database connection closed")
+	c.stopConnecting()
+	if h := c.pool.Swap(nil); h != nil {
+		h.retire()
+		h.pool.Close()
+		c.events().log(context.Background(), LogEventClosed, slog.LevelInfo, "database connection closed")
 	}
 }
 
@@ -240,16 +414,18 @@ func (c *Connection) Close() {
 //
 // Returns error if pool uninitialized or SELECT 1 fails.
 func (c *Connection) Health(ctx context.Context) error {
-	if c.pool == nil {
-		return errors.New("database pool not initialized")
+	h, err := c.usePool(ctx)
+	if err != nil {
+		return err
 	}
+	defer h.release()
 
 	// Use configured health timeout
 	healthCtx, cancel := context.WithTimeout(ctx, c.opts.healthTimeout)
 	defer cancel()
 
 	var result int
-	err := c.pool.QueryRow(healthCtx, "SELECT 1").Scan(&result)
+	err = h.pool.QueryRow(healthCtx, "SELECT 1").Scan(&result)
 	if err != nil {
 		return fmt.Errorf("health check failed: %w", err)
 	}
@@ -263,59 +439,89 @@ func (c *Connection) Health(ctx context.Context) error {
 
 // Stats returns pool metrics or nil if uninitialized.
 func (c *Connection) Stats() *pgxpool.Stat {
-	if c.pool == nil {
+	pool := c.currentPool()
+	if pool == nil {
 		return nil
 	}
-	return c.pool.Stat()
+	return pool.Stat()
 }
 
 // Pool exposes the underlying pgxpool for advanced operations.
 //
-// Prefer Connection methods; direct pool access bypasses initialization checks.
+// Prefer Connection methods; direct pool access bypasses initialization checks,
+// and the returned pool is closed once ResetPool replaces it and its
+// connections are released.
 func (c *Connection) Pool() *pgxpool.Pool {
-	return c.pool
+	return c.currentPool()
 }
 
 // Exec executes queries without result rows (INSERT, UPDATE, DELETE).
 func (c *Connection) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
-	if c.pool == nil {
-		return pgconn.CommandTag{}, errors.New("database pool not initialized")
+	h, err := c.usePool(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
 	}
-	return c.pool.Exec(ctx, sql, args...)
+	defer h.release()
+
+	tag, err := h.pool.Exec(ctx, sql, args...)
+	return tag, c.classify(err)
 }
 
 // Query executes queries returning multiple rows.
 func (c *Connection) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
-	if c.pool == nil {
-		return nil, errors.New("database pool not initialized")
+	h, err := c.usePool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer h.release()
+
+	rows, err := h.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return rows, c.classify(err)
+	}
+	if c.opts.classifyErrors {
+		return classifyingRows{Rows: rows}, nil
 	}
-	return c.pool.Query(ctx, sql, args...)
+	return rows, nil
 }
 
 // QueryRow executes queries expecting single row.
 //
 // Returns emptyRow with error if pool uninitialized.
 func (c *Connection) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
-	if c.pool == nil {
-		return &emptyRow{err: errors.New("database pool not initialized")}
+	h, err := c.usePool(ctx)
+	if err != nil {
+		return &emptyRow{err: err}
+	}
+	defer h.release()
+
+	row := h.pool.QueryRow(ctx, sql, args...)
+	if c.opts.classifyErrors {
+		return classifyingRow{row: row}
 	}
-	return c.pool.QueryRow(ctx, sql, args...)
+	return row
 }
 
 // Begin starts a transaction with default isolation level.
 func (c *Connection) Begin(ctx context.Context) (pgx.Tx, error) {
-	if c.pool == nil {
-		return nil, errors.New("database pool not initialized")
+	h, err := c.usePool(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return c.pool.Begin(ctx)
+	defer h.release()
+
+	return h.pool.Begin(ctx)
 }
 
 // BeginTx starts a transaction with custom isolation and access mode.
 func (c *Connection) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
-	if c.pool == nil {
-		return nil, errors.New("database pool not initialized")
+	h, err := c.usePool(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return c.pool.BeginTx(ctx, txOptions)
+	defer h.release()
+
+	return h.pool.BeginTx(ctx, txOptions)
 }
 
 // emptyRow implements pgx.Row for uninitialized pool errors.
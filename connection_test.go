@@ -2,6 +2,7 @@ package pgxutils
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"testing"
 	"time"
@@ -77,10 +78,25 @@ func TestNewConnection(t *testing.T) {
 			SSLMode:  "disable",
 		}
 
-		logger := slog.Default()
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 		conn, err := NewConnection(cfg, WithLogger(logger))
 		require.NoError(t, err)
-		assert.NotNil(t, conn.logger)
+		assert.Same(t, logger, conn.logger)
+	})
+
+	t.Run("with nil logger falls back to default", func(t *testing.T) {
+		cfg := &config.DatabaseConfig{
+			Host:     "localhost",
+			Port:     5432,
+			Database: "testdb",
+			User:     "testuser",
+			Password: "testpass",
+			SSLMode:  "disable",
+		}
+
+		conn, err := NewConnection(cfg, WithLogger(nil))
+		require.NoError(t, err)
+		assert.Same(t, slog.Default(), conn.logger)
 	})
 }
 
@@ -0,0 +1,91 @@
+package pgxutils
+
+import (
+	"time"
+)
+
+// SQLSTATE codes for connection failures that retrying cannot fix.
+const (
+	sqlStateInvalidAuthorization = "28000"
+	sqlStateInvalidPassword      = "28P01"
+	sqlStateInvalidCatalogName   = "3D000"
+)
+
+// ConnectRetryPolicy controls how Connect retries failed connection attempts.
+//
+// The delay before each retry is chosen at random between zero and a ceiling
+// that starts at InitialDelay and grows by Multiplier each attempt, up to
+// MaxDelay. Zero fields take the defaults of DefaultConnectRetryPolicy.
+type ConnectRetryPolicy struct {
+	// InitialDelay is the ceiling of the delay before the first retry.
+	InitialDelay time.Duration
+	// MaxDelay caps the ceiling as it grows.
+	MaxDelay time.Duration
+	// Multiplier is the growth of the ceiling per attempt.
+	Multiplier float64
+	// MaxAttempts limits the number of attempts. Zero means attempts continue
+	// until the retry timeout set by WithRetryTimeout.
+	MaxAttempts int
+	// OnAttempt, if set, is called after every attempt with its number, its
+	// error (nil on success) and the delay before the next attempt, which is
+	// zero when there will be none.
+	OnAttempt func(attempt int, err error, delay time.Duration)
+}
+
+// DefaultConnectRetryPolicy returns the policy Connect uses unless
+// WithConnectRetryPolicy is given: delays from 500ms growing twofold up to 10s,
+// until the retry timeout.
+func DefaultConnectRetryPolicy() ConnectRetryPolicy {
+	return ConnectRetryPolicy{
+		InitialDelay: 500 * time.Millisecond,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2,
+	}
+}
+
+// WithConnectRetryPolicy sets how Connect retries failed attempts.
+// Default is DefaultConnectRetryPolicy.
+func WithConnectRetryPolicy(policy ConnectRetryPolicy) Option {
+	return func(opts *connectionOptions) {
+		opts.connectRetry = policy
+	}
+}
+
+// withDefaults fills zero fields from DefaultConnectRetryPolicy.
+func (p ConnectRetryPolicy) withDefaults() ConnectRetryPolicy {
+	defaults := DefaultConnectRetryPolicy()
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = defaults.InitialDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaults.MaxDelay
+	}
+	if p.MaxDelay < p.InitialDelay {
+		p.MaxDelay = p.InitialDelay
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaults.Multiplier
+	}
+	return p
+}
+
+// backoff returns the policy's delays as a backoff.
+func (p ConnectRetryPolicy) backoff() backoff {
+	return backoff{
+		initial:    p.InitialDelay,
+		max:        p.MaxDelay,
+		multiplier: p.Multiplier,
+	}
+}
+
+// isPermanentConnectError reports whether a failed connection attempt was
+// rejected in a way another attempt would not change: bad credentials, or a
+// database that does not exist.
+func isPermanentConnectError(err error) bool {
+	switch SQLState(err) {
+	case sqlStateInvalidAuthorization, sqlStateInvalidPassword, sqlStateInvalidCatalogName:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,145 @@
+package pgxutils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectRetryPolicy_WithDefaults(t *testing.T) {
+	assert.Equal(t, DefaultConnectRetryPolicy(), ConnectRetryPolicy{}.withDefaults())
+
+	p := ConnectRetryPolicy{InitialDelay: time.Second, MaxDelay: time.Millisecond, Multiplier: 0.5}.withDefaults()
+	assert.Equal(t, time.Second, p.InitialDelay)
+	assert.Equal(t, time.Second, p.MaxDelay, "max is raised to the initial delay")
+	assert.Equal(t, 2.0, p.Multiplier)
+}
+
+func TestIsPermanentConnectError(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"28P01", true},
+		{"28000", true},
+		{"3D000", true},
+		{"57P03", false},
+		{"08006", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			err := fmt.Errorf("connect: %w", &pgconn.PgError{Code: tt.code})
+			assert.Equal(t, tt.want, isPermanentConnectError(err))
+		})
+	}
+	assert.False(t, isPermanentConnectError(&net.OpError{Op: "dial", Err: fmt.Errorf("refused")}))
+}
+
+func TestConnect_RetryPolicyMaxAttempts(t *testing.T) {
+	type attempt struct {
+		n     int
+		err   error
+		delay time.Duration
+	}
+	var attempts []attempt
+
+	conn := unreachableConnection(t, WithConnectRetryPolicy(ConnectRetryPolicy{
+		InitialDelay: time.Millisecond,
+		MaxDelay:     5 * time.Millisecond,
+		MaxAttempts:  3,
+		OnAttempt: func(n int, err error, delay time.Duration) {
+			attempts = append(attempts, attempt{n, err, delay})
+		},
+	}))
+
+	err := conn.Connect(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect after 3 attempts")
+
+	// The timeout error reports the time spent, not the unused retry timeout
+	var timeoutErr *errors.TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Less(t, timeoutErr.Duration, conn.opts.retryTimeout)
+
+	require.Len(t, attempts, 3)
+	for i, a := range attempts {
+		assert.Equal(t, i+1, a.n)
+		assert.Error(t, a.err)
+		assert.LessOrEqual(t, a.delay, 5*time.Millisecond)
+	}
+	assert.Zero(t, attempts[2].delay, "no delay follows the last attempt")
+}
+
+func TestConnect_CancelDuringBackoff(t *testing.T) {
+	conn := unreachableConnection(t, WithConnectRetryPolicy(ConnectRetryPolicy{
+		InitialDelay: time.Minute,
+		MaxDelay:     time.Minute,
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := conn.Connect(ctx)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// rejectingServer accepts PostgreSQL connections and fails each startup with
+// the given SQLSTATE, counting the attempts.
+func rejectingServer(t *testing.T, code string) (port int, attempts *atomic.Int32) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	attempts = &atomic.Int32{}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			attempts.Add(1)
+			backend := pgproto3.NewBackend(c, c)
+			if _, err := backend.ReceiveStartupMessage(); err == nil {
+				backend.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: code, Message: "rejected"})
+				_ = backend.Flush()
+			}
+			_ = c.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, attempts
+}
+
+func TestConnect_AbortsOnPermanentErrors(t *testing.T) {
+	for _, code := range []string{"28P01", "3D000"} {
+		t.Run(code, func(t *testing.T) {
+			port, attempts := rejectingServer(t, code)
+
+			cfg := baseConfig()
+			cfg.Host = "127.0.0.1"
+			cfg.Port = port
+			conn, err := NewConnection(cfg, WithRetryTimeout(10*time.Second))
+			require.NoError(t, err)
+
+			start := time.Now()
+			err = conn.Connect(context.Background())
+			require.Error(t, err)
+			assert.Equal(t, code, SQLState(err))
+			assert.Less(t, time.Since(start), 2*time.Second)
+			assert.Equal(t, int32(1), attempts.Load())
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package pgxutils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/jackc/pgx/v5"
+)
+
+// credentialRefreshMargin is how long before they expire credentials are
+// fetched again, so a connection never starts with a token about to lapse.
+const credentialRefreshMargin = 30 * time.Second
+
+// Credentials are the user and password for new connections.
+type Credentials struct {
+	// User replaces the configured user when non-empty.
+	User string
+	// Password is the password or token to authenticate with.
+	Password string
+	// ExpiresAt is when the credentials stop being valid. Zero means they
+	// are cached for the WithCredentialTTL duration.
+	ExpiresAt time.Time
+}
+
+// CredentialProvider supplies credentials for new connections, such as a
+// password rotated by a secrets manager or a short-lived IAM token.
+//
+// Implementations must be safe for concurrent use.
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialProviderFunc adapts a function to a CredentialProvider.
+//
+// Example usage:
+//
+//	provider := pgxutils.CredentialProviderFunc(func(ctx context.Context) (pgxutils.Credentials, error) {
+//	    token, err := iam.AuthToken(ctx, endpoint, region, user)
+//	    return pgxutils.Credentials{Password: token, ExpiresAt: time.Now().Add(15 * time.Minute)}, err
+//	})
+type CredentialProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials implements CredentialProvider.
+func (f CredentialProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// WithCredentialProvider consults provider before every new physical
+// connection, so pooled connections opened after a rotation use the new
+// credentials without ResetPool. Existing connections are unaffected.
+//
+// The provider's credentials replace the DatabaseConfig's Password, and its
+// User when set. They are cached until shortly before ExpiresAt, or until the
+// server rejects them, so a connection after an early rotation asks again.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(opts *connectionOptions) {
+		opts.credentialProvider = provider
+	}
+}
+
+// WithCredentialTTL sets how long credentials without an ExpiresAt are reused
+// before the provider is asked again.
+// Default is zero, which asks the provider for every new connection.
+func WithCredentialTTL(ttl time.Duration) Option {
+	return func(opts *connectionOptions) {
+		opts.credentialTTL = ttl
+	}
+}
+
+// credentialCache caches a provider's credentials until they expire.
+type credentialCache struct {
+	provider CredentialProvider
+	ttl      time.Duration
+
+	mu          sync.Mutex
+	credentials Credentials
+	validUntil  time.Time
+}
+
+// get returns cached credentials, asking the provider when they have expired.
+// The lock is held while fetching so concurrent connects share one request.
+func (c *credentialCache) get(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(c.validUntil) {
+		return c.credentials, nil
+	}
+
+	credentials, err := c.provider.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	c.credentials = credentials
+	switch {
+	case !credentials.ExpiresAt.IsZero():
+		c.validUntil = credentials.ExpiresAt.Add(-credentialRefreshMargin)
+	default:
+		c.validUntil = now.Add(c.ttl)
+	}
+	return credentials, nil
+}
+
+// invalidate drops the cached credentials, so the next get asks the provider.
+func (c *credentialCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.validUntil = time.Time{}
+}
+
+// password returns the last fetched password, for redaction.
+func (c *credentialCache) password() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.credentials.Password
+}
+
+// applyCredentials applies the provider's credentials to a new connection.
+func (c *Connection) applyCredentials(ctx context.Context, cc *pgx.ConnConfig) error {
+	credentials, err := c.credentials.get(ctx)
+	if err != nil {
+		return errors.NewProcessingError(
+			"failed to get database credentials",
+			"database_credentials",
+			errors.WithCause(redactError(err, c.secrets()...)),
+		)
+	}
+
+	if credentials.User != "" {
+		cc.User = credentials.User
+	}
+	cc.Password = credentials.Password
+	return nil
+}
+
+// credentialTracer invalidates the credential cache when a new connection
+// fails authentication, as when the password was rotated before the cached
+// credentials expired.
+type credentialTracer struct {
+	cache *credentialCache
+}
+
+var (
+	_ pgx.QueryTracer   = (*credentialTracer)(nil)
+	_ pgx.ConnectTracer = (*credentialTracer)(nil)
+)
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *credentialTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *credentialTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// TraceConnectStart implements pgx.ConnectTracer.
+func (t *credentialTracer) TraceConnectStart(ctx context.Context, _ pgx.TraceConnectStartData) context.Context {
+	return ctx
+}
+
+// TraceConnectEnd implements pgx.ConnectTracer.
+func (t *credentialTracer) TraceConnectEnd(_ context.Context, data pgx.TraceConnectEndData) {
+	switch SQLState(data.Err) {
+	case sqlStateInvalidPassword, sqlStateInvalidAuthorization:
+		t.cache.invalidate()
+	}
+}
+
+// FileCredentialProvider reads the password from a file, such as a secret
+// mounted into a container, and rereads it whenever the file changes.
+//
+// The file is checked on every call, which with the default zero
+// WithCredentialTTL means before every new connection. Surrounding whitespace,
+// including the trailing newline most tools write, is trimmed.
+type FileCredentialProvider struct {
+	passwordFile string
+	userFile     string
+
+	mu      sync.Mutex
+	current Credentials
+	stamps  [2]fileStamp
+}
+
+// fileStamp identifies a version of a file by size and modification time.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// fileChanged stats path and reports whether it differs from last.
+func fileChanged(path string, last fileStamp) (fileStamp, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, false, err
+	}
+
+	stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+	return stamp, stamp.size != last.size || !stamp.modTime.Equal(last.modTime), nil
+}
+
+// FileCredentialOption configures a FileCredentialProvider.
+type FileCredentialOption func(*FileCredentialProvider)
+
+// WithUserFile also reads the user from a file.
+// Default keeps the DatabaseConfig's User.
+func WithUserFile(path string) FileCredentialOption {
+	return func(p *FileCredentialProvider) {
+		p.userFile = path
+	}
+}
+
+// NewFileCredentialProvider creates a provider reading the password from
+// passwordFile. The file is first read on the first connection.
+//
+// Example usage:
+//
+//	conn, err := pgxutils.NewConnection(cfg.Database,
+//	    pgxutils.WithCredentialProvider(
+//	        pgxutils.NewFileCredentialProvider("/var/run/secrets/db/password"),
+//	    ),
+//	)
+func NewFileCredentialProvider(passwordFile string, opts ...FileCredentialOption) *FileCredentialProvider {
+	p := &FileCredentialProvider{passwordFile: passwordFile}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(p)
+		}
+	}
+	return p
+}
+
+// Credentials implements CredentialProvider.
+func (p *FileCredentialProvider) Credentials(_ context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	password, passwordStamp, err := p.readIfChanged(p.passwordFile, p.stamps[0], p.current.Password)
+	if err != nil {
+		return Credentials{}, err
+	}
+	user, userStamp := "", fileStamp{}
+	if p.userFile != "" {
+		user, userStamp, err = p.readIfChanged(p.userFile, p.stamps[1], p.current.User)
+		if err != nil {
+			return Credentials{}, err
+		}
+	}
+
+	p.current = Credentials{User: user, Password: password}
+	p.stamps = [2]fileStamp{passwordStamp, userStamp}
+	return p.current, nil
+}
+
+// readIfChanged returns the trimmed content of path, rereading it only when
+// its stamp differs from last.
+func (p *FileCredentialProvider) readIfChanged(path string, last fileStamp, value string) (string, fileStamp, error) {
+	stamp, changed, err := fileChanged(path, last)
+	if err != nil {
+		return "", fileStamp{}, fmt.Errorf("failed to stat credential file: %w", err)
+	}
+	if !changed {
+		return value, stamp, nil
+	}
+
+	content, err := os.ReadFile(path) // #nosec G304 - path is set by the application
+	if err != nil {
+		return "", fileStamp{}, fmt.Errorf("failed to read credential file: %w", err)
+	}
+
+	// An empty file is usually a secret caught mid-update
+	value = string(bytes.TrimSpace(content))
+	if value == "" {
+		return "", fileStamp{}, errors.New("credential file is empty: " + path)
+	}
+	return value, stamp, nil
+}
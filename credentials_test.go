@@ -0,0 +1,193 @@
+package pgxutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingProvider returns the given credentials and counts its calls.
+func countingProvider(credentials Credentials, err error) (CredentialProvider, *atomic.Int32) {
+	var calls atomic.Int32
+	return CredentialProviderFunc(func(context.Context) (Credentials, error) {
+		calls.Add(1)
+		return credentials, err
+	}), &calls
+}
+
+func TestCredentialCache(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		credentials Credentials
+		ttl         time.Duration
+		wantCalls   int32
+	}{
+		{
+			name:        "no expiry and no ttl asks every time",
+			credentials: Credentials{Password: "p"},
+			wantCalls:   3,
+		},
+		{
+			name:        "ttl caches credentials without expiry",
+			credentials: Credentials{Password: "p"},
+			ttl:         time.Minute,
+			wantCalls:   1,
+		},
+		{
+			name:        "cached until expiry",
+			credentials: Credentials{Password: "p", ExpiresAt: time.Now().Add(time.Hour)},
+			wantCalls:   1,
+		},
+		{
+			name:        "refreshed within the margin before expiry",
+			credentials: Credentials{Password: "p", ExpiresAt: time.Now().Add(credentialRefreshMargin / 2)},
+			ttl:         time.Hour,
+			wantCalls:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, calls := countingProvider(tt.credentials, nil)
+			cache := &credentialCache{provider: provider, ttl: tt.ttl}
+
+			for range 3 {
+				credentials, err := cache.get(ctx)
+				require.NoError(t, err)
+				assert.Equal(t, "p", credentials.Password)
+			}
+			assert.Equal(t, tt.wantCalls, calls.Load())
+		})
+	}
+}
+
+func TestCredentialCache_ErrorsAreNotCached(t *testing.T) {
+	provider, calls := countingProvider(Credentials{}, errors.New("secrets manager unavailable"))
+	cache := &credentialCache{provider: provider, ttl: time.Hour}
+
+	_, err := cache.get(context.Background())
+	require.Error(t, err)
+	_, err = cache.get(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestConnection_AuthFailureInvalidatesCredentials(t *testing.T) {
+	provider, calls := countingProvider(Credentials{Password: "p"}, nil)
+	conn, err := NewConnection(baseConfig(), WithCredentialProvider(provider), WithCredentialTTL(time.Hour))
+	require.NoError(t, err)
+
+	poolConfig, err := conn.buildPoolConfig()
+	require.NoError(t, err)
+	tracer, ok := poolConfig.ConnConfig.Tracer.(pgx.ConnectTracer)
+	require.True(t, ok)
+
+	connect := func(connectErr error) {
+		require.NoError(t, conn.beforeConnect(context.Background(), poolConfig.ConnConfig.Copy()))
+		ctx := tracer.TraceConnectStart(context.Background(), pgx.TraceConnectStartData{})
+		tracer.TraceConnectEnd(ctx, pgx.TraceConnectEndData{Err: connectErr})
+	}
+
+	connect(nil)
+	connect(&pgconn.PgError{Code: "08006"})
+	assert.Equal(t, int32(1), calls.Load(), "other failures keep the cached credentials")
+
+	connect(&pgconn.PgError{Code: sqlStateInvalidPassword})
+	connect(nil)
+	assert.Equal(t, int32(2), calls.Load(), "a rejected password is fetched again")
+}
+
+func TestConnection_BeforeConnectAppliesCredentials(t *testing.T) {
+	provider, _ := countingProvider(Credentials{User: "rotated_user", Password: "rotated"}, nil)
+	conn, err := NewConnection(baseConfig(), WithCredentialProvider(provider))
+	require.NoError(t, err)
+
+	poolConfig, err := conn.buildPoolConfig()
+	require.NoError(t, err)
+	require.NotNil(t, poolConfig.BeforeConnect)
+
+	cc := poolConfig.ConnConfig.Copy()
+	require.NoError(t, poolConfig.BeforeConnect(context.Background(), cc))
+	assert.Equal(t, "rotated_user", cc.User)
+	assert.Equal(t, "rotated", cc.Password)
+	assert.Contains(t, conn.secrets(), "rotated")
+}
+
+func TestConnection_BeforeConnectKeepsConfiguredUser(t *testing.T) {
+	provider, _ := countingProvider(Credentials{Password: "rotated"}, nil)
+	conn, err := NewConnection(baseConfig(), WithCredentialProvider(provider))
+	require.NoError(t, err)
+
+	cc := &pgx.ConnConfig{}
+	cc.User = "testuser"
+	require.NoError(t, conn.beforeConnect(context.Background(), cc))
+	assert.Equal(t, "testuser", cc.User)
+	assert.Equal(t, "rotated", cc.Password)
+}
+
+func TestConnection_BeforeConnectProviderError(t *testing.T) {
+	provider, _ := countingProvider(Credentials{}, errors.New("token service down"))
+	conn, err := NewConnection(baseConfig(), WithCredentialProvider(provider))
+	require.NoError(t, err)
+
+	err = conn.beforeConnect(context.Background(), &pgx.ConnConfig{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get database credentials")
+}
+
+func TestBuildPoolConfig_NoProviderNoBeforeConnect(t *testing.T) {
+	conn, err := NewConnection(baseConfig())
+	require.NoError(t, err)
+
+	poolConfig, err := conn.buildPoolConfig()
+	require.NoError(t, err)
+	assert.Nil(t, poolConfig.BeforeConnect)
+}
+
+func TestFileCredentialProvider(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	userFile := filepath.Join(dir, "user")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("first\n"), 0o600))
+	require.NoError(t, os.WriteFile(userFile, []byte("app\n"), 0o600))
+
+	provider := NewFileCredentialProvider(passwordFile, WithUserFile(userFile))
+
+	credentials, err := provider.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{User: "app", Password: "first"}, credentials)
+
+	// A rotated secret is picked up on the next call
+	require.NoError(t, os.WriteFile(passwordFile, []byte("second\n"), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(passwordFile, later, later))
+
+	credentials, err = provider.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{User: "app", Password: "second"}, credentials)
+}
+
+func TestFileCredentialProvider_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewFileCredentialProvider(filepath.Join(dir, "missing")).Credentials(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to stat credential file")
+
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, []byte("\n"), 0o600))
+	_, err = NewFileCredentialProvider(empty).Credentials(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "credential file is empty")
+}
@@ -0,0 +1,206 @@
+package pgxutils
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Sentinel errors identifying the category ClassifyError assigned. Test with
+// errors.Is; the original *pgconn.PgError stays reachable through errors.As.
+var (
+	ErrConflict     = stderrors.New("conflict")
+	ErrConstraint   = stderrors.New("constraint violation")
+	ErrQueryTimeout = stderrors.New("query timeout")
+	ErrUnavailable  = stderrors.New("database unavailable")
+	ErrNotFound     = stderrors.New("not found")
+)
+
+// classifyOperation is the jp-go-errors operation recorded on classified errors.
+const classifyOperation = "database_query"
+
+// ClassifyError converts PostgreSQL and pgx errors into jp-go-errors types.
+//
+//   - unique_violation, exclusion_violation: processing error wrapping ErrConflict
+//   - foreign_key, check and not_null violations: validation error naming the
+//     column or constraint, wrapping ErrConstraint
+//   - query_canceled, lock_not_available: timeout error wrapping ErrQueryTimeout
+//   - connection exceptions (class 08), shutdowns and connect failures:
+//     transient network error wrapping ErrUnavailable, so errors.IsNetworkError
+//     and errors.IsRetryable report true
+//   - pgx.ErrNoRows: not-found error wrapping ErrNotFound, so errors.IsNotFound
+//     reports true
+//
+// Any other error, nil, and errors already classified are returned unchanged.
+// The original error remains in the chain, so errors.Is(err, pgx.ErrNoRows)
+// and errors.As(err, &pgErr) keep working.
+func ClassifyError(err error) error {
+	if err == nil || isClassified(err) {
+		return err
+	}
+
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return errors.NewNotFoundError("no rows found", fmt.Errorf("%w: %w", ErrNotFound, err))
+	}
+
+	var pgErr *pgconn.PgError
+	if !stderrors.As(err, &pgErr) {
+		var connectErr *pgconn.ConnectError
+		if stderrors.As(err, &connectErr) {
+			return unavailableError(err)
+		}
+		return err
+	}
+
+	switch {
+	case pgErr.Code == "23505":
+		return errors.NewProcessingError(
+			fmt.Sprintf("unique constraint %q violated", pgErr.ConstraintName),
+			classifyOperation,
+			errors.WithCause(fmt.Errorf("%w: %w", ErrConflict, err)),
+		)
+	case pgErr.Code == "23P01":
+		return errors.NewProcessingError(
+			fmt.Sprintf("exclusion constraint %q violated", pgErr.ConstraintName),
+			classifyOperation,
+			errors.WithCause(fmt.Errorf("%w: %w", ErrConflict, err)),
+		)
+	case pgErr.Code == "23503":
+		return constraintError("foreign key constraint", pgErr, err)
+	case pgErr.Code == "23514":
+		return constraintError("check constraint", pgErr, err)
+	case pgErr.Code == "23502":
+		return constraintError("not-null constraint", pgErr, err)
+	case pgErr.Code == "57014":
+		return errors.NewTimeoutError(
+			"query canceled",
+			classifyOperation,
+			0,
+			errors.WithCause(fmt.Errorf("%w: %w", ErrQueryTimeout, err)),
+		)
+	case pgErr.Code == "55P03":
+		return errors.NewTimeoutError(
+			"lock not available",
+			classifyOperation,
+			0,
+			errors.WithCause(fmt.Errorf("%w: %w", ErrQueryTimeout, err)),
+		)
+	case strings.HasPrefix(pgErr.Code, "08"),
+		pgErr.Code == "57P01", // admin_shutdown
+		pgErr.Code == "57P02", // crash_shutdown
+		pgErr.Code == "57P03": // cannot_connect_now
+		return unavailableError(err)
+	default:
+		return err
+	}
+}
+
+// constraintError builds a validation error naming the violated column, or the
+// constraint when PostgreSQL does not report a column.
+func constraintError(kind string, pgErr *pgconn.PgError, err error) error {
+	field := pgErr.ColumnName
+	if field == "" {
+		field = pgErr.ConstraintName
+	}
+
+	msg := kind + " violated"
+	if pgErr.ConstraintName != "" {
+		msg = fmt.Sprintf("%s %q violated", kind, pgErr.ConstraintName)
+	}
+
+	return errors.NewValidationError(
+		msg,
+		field,
+		errors.WithCause(fmt.Errorf("%w: %w", ErrConstraint, err)),
+	)
+}
+
+// unavailableError builds a transient network error for a database that
+// cannot be reached or is going away.
+func unavailableError(err error) error {
+	return errors.NewNetworkError(
+		"database unavailable",
+		classifyOperation,
+		errors.WithCause(fmt.Errorf("%w: %w", ErrUnavailable, err)),
+	)
+}
+
+// isClassified reports whether ClassifyError already handled err.
+func isClassified(err error) bool {
+	return stderrors.Is(err, ErrConflict) ||
+		stderrors.Is(err, ErrConstraint) ||
+		stderrors.Is(err, ErrQueryTimeout) ||
+		stderrors.Is(err, ErrUnavailable) ||
+		stderrors.Is(err, ErrNotFound)
+}
+
+// WithErrorClassification applies ClassifyError to every error returned by the
+// Connection's Exec, Query, QueryRow, SendBatch and CopyFrom, including errors
+// surfaced later through Rows, Row and BatchResults, and to commit errors of
+// the transaction helpers.
+// Disabled by default.
+func WithErrorClassification() Option {
+	return func(opts *connectionOptions) {
+		opts.classifyErrors = true
+	}
+}
+
+// classify applies ClassifyError when WithErrorClassification is set.
+func (c *Connection) classify(err error) error {
+	if !c.opts.classifyErrors {
+		return err
+	}
+	return ClassifyError(err)
+}
+
+// classifyingRow classifies the error from Scan.
+type classifyingRow struct {
+	row pgx.Row
+}
+
+func (r classifyingRow) Scan(dest ...any) error {
+	return ClassifyError(r.row.Scan(dest...))
+}
+
+// classifyingRows classifies errors from Scan and Err.
+type classifyingRows struct {
+	pgx.Rows
+}
+
+func (r classifyingRows) Err() error {
+	return ClassifyError(r.Rows.Err())
+}
+
+func (r classifyingRows) Scan(dest ...any) error {
+	return ClassifyError(r.Rows.Scan(dest...))
+}
+
+// classifyingBatchResults classifies errors from every result.
+type classifyingBatchResults struct {
+	results pgx.BatchResults
+}
+
+func (b classifyingBatchResults) Exec() (pgconn.CommandTag, error) {
+	tag, err := b.results.Exec()
+	return tag, ClassifyError(err)
+}
+
+func (b classifyingBatchResults) Query() (pgx.Rows, error) {
+	rows, err := b.results.Query()
+	if err != nil {
+		return rows, ClassifyError(err)
+	}
+	return classifyingRows{Rows: rows}, nil
+}
+
+func (b classifyingBatchResults) QueryRow() pgx.Row {
+	return classifyingRow{row: b.results.QueryRow()}
+}
+
+func (b classifyingBatchResults) Close() error {
+	return ClassifyError(b.results.Close())
+}
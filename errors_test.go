@@ -0,0 +1,118 @@
+package pgxutils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		sentinel   error
+		validation bool
+	}{
+		{"unique violation", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}, ErrConflict, false},
+		{"exclusion violation", &pgconn.PgError{Code: "23P01"}, ErrConflict, false},
+		{"foreign key violation", &pgconn.PgError{Code: "23503", ConstraintName: "orders_user_id_fkey"}, ErrConstraint, true},
+		{"check violation", &pgconn.PgError{Code: "23514", ConstraintName: "positive_amount"}, ErrConstraint, true},
+		{"not null violation", &pgconn.PgError{Code: "23502", ColumnName: "email"}, ErrConstraint, true},
+		{"query canceled", &pgconn.PgError{Code: "57014"}, ErrQueryTimeout, false},
+		{"lock not available", &pgconn.PgError{Code: "55P03"}, ErrQueryTimeout, false},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, ErrUnavailable, false},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, ErrUnavailable, false},
+		{"cannot connect now", &pgconn.PgError{Code: "57P03"}, ErrUnavailable, false},
+		{"no rows", pgx.ErrNoRows, ErrNotFound, false},
+		{"wrapped no rows", fmt.Errorf("load user: %w", pgx.ErrNoRows), ErrNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ClassifyError(tt.err)
+
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, tt.sentinel))
+			assert.True(t, errors.Is(err, tt.err), "original error must stay in the chain")
+			assert.Equal(t, tt.validation, errors.IsValidation(err))
+		})
+	}
+}
+
+func TestClassifyError_JPErrorsTypes(t *testing.T) {
+	notFound := ClassifyError(pgx.ErrNoRows)
+	assert.True(t, errors.IsNotFound(notFound))
+	assert.False(t, errors.IsRetryable(notFound))
+
+	for _, code := range []string{"08006", "57P01"} {
+		unavailable := ClassifyError(&pgconn.PgError{Code: code})
+		assert.True(t, errors.IsNetworkError(unavailable), code)
+		assert.True(t, errors.IsRetryable(unavailable), code)
+	}
+
+	conflict := ClassifyError(&pgconn.PgError{Code: "23505"})
+	assert.False(t, errors.IsNotFound(conflict))
+	assert.False(t, errors.IsNetworkError(conflict))
+}
+
+func TestWithErrorClassification_Commit(t *testing.T) {
+	conn, err := NewConnection(baseConfig(), WithErrorClassification())
+	require.NoError(t, err)
+
+	outer := &fakeTx{commitErr: &pgconn.PgError{Code: "23505"}}
+	ctx := ContextWithTx(context.Background(), outer)
+	noop := func(pgx.Tx) error { return nil }
+
+	err = conn.WithTransaction(ctx, noop)
+	assert.True(t, errors.Is(err, ErrConflict), "Connection.WithTransaction: %v", err)
+
+	err = WithTransaction(ctx, conn, nil, noop)
+	assert.True(t, errors.Is(err, ErrConflict), "WithTransaction: %v", err)
+	assert.Equal(t, "23505", SQLState(err))
+}
+
+func TestClassifyError_KeepsSQLState(t *testing.T) {
+	err := ClassifyError(&pgconn.PgError{Code: "23505"})
+
+	assert.Equal(t, "23505", SQLState(err))
+}
+
+func TestClassifyError_NamesColumnOrConstraint(t *testing.T) {
+	err := ClassifyError(&pgconn.PgError{Code: "23502", ColumnName: "email"})
+	assert.Contains(t, err.Error(), "not-null constraint")
+
+	err = ClassifyError(&pgconn.PgError{Code: "23503", ConstraintName: "orders_user_id_fkey"})
+	assert.Contains(t, err.Error(), "orders_user_id_fkey")
+}
+
+func TestClassifyError_Unchanged(t *testing.T) {
+	assert.NoError(t, ClassifyError(nil))
+
+	plain := errors.New("boom")
+	assert.Equal(t, plain, ClassifyError(plain))
+
+	syntax := &pgconn.PgError{Code: "42601"}
+	assert.Same(t, syntax, ClassifyError(syntax))
+}
+
+func TestClassifyError_Idempotent(t *testing.T) {
+	once := ClassifyError(&pgconn.PgError{Code: "23505"})
+
+	assert.Equal(t, once, ClassifyError(once))
+}
+
+func TestWithErrorClassification(t *testing.T) {
+	conn, err := NewConnection(baseConfig(), WithErrorClassification())
+	require.NoError(t, err)
+	assert.True(t, conn.opts.classifyErrors)
+
+	conn, err = NewConnection(baseConfig())
+	require.NoError(t, err)
+	assert.False(t, conn.opts.classifyErrors)
+}
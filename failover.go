@@ -0,0 +1,184 @@
+package pgxutils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LogEventFailoverDetected is logged when a write lands on a read-only server
+// and the pool is reset to find the new primary.
+const LogEventFailoverDetected LogEvent = "failover_detected"
+
+// TargetSessionAttrs selects which of several hosts a Connection uses, with
+// the same values and semantics as libpq's target_session_attrs.
+type TargetSessionAttrs string
+
+const (
+	// TargetAny accepts any server. This is the default.
+	TargetAny TargetSessionAttrs = "any"
+	// TargetReadWrite accepts a server that allows writes by default.
+	TargetReadWrite TargetSessionAttrs = "read-write"
+	// TargetReadOnly accepts a server that disallows writes by default.
+	TargetReadOnly TargetSessionAttrs = "read-only"
+	// TargetPrimary accepts a server that is not in recovery.
+	TargetPrimary TargetSessionAttrs = "primary"
+	// TargetStandby accepts a server that is in recovery.
+	TargetStandby TargetSessionAttrs = "standby"
+	// TargetPreferStandby tries standbys first, then any server.
+	TargetPreferStandby TargetSessionAttrs = "prefer-standby"
+)
+
+// sqlStateReadOnlyTransaction is returned for writes on a read-only server.
+const sqlStateReadOnlyTransaction = "25006"
+
+// failoverResetInterval bounds how often a failover resets the pool.
+const failoverResetInterval = time.Second
+
+// WithHosts sets the hosts tried, in order, for every new connection, replacing
+// the DatabaseConfig's Host. Each entry is "host" or "host:port"; the port
+// defaults to the DatabaseConfig's Port. IPv6 addresses with a port need
+// brackets, as in "[::1]:5432".
+//
+// Combine with WithTargetSessionAttrs to connect to whichever host currently
+// has the wanted role, such as the primary of a Patroni cluster.
+func WithHosts(hosts ...string) Option {
+	return func(opts *connectionOptions) {
+		opts.hosts = append([]string(nil), hosts...)
+	}
+}
+
+// WithTargetSessionAttrs sets which server each new connection must land on.
+//
+// With TargetReadWrite or TargetPrimary, a statement failing because the
+// server has become read-only resets the pool, so that after a failover new
+// connections find the promoted primary.
+// Default is TargetAny.
+func WithTargetSessionAttrs(attrs TargetSessionAttrs) Option {
+	return func(opts *connectionOptions) {
+		opts.targetSessionAttrs = attrs
+	}
+}
+
+// hostList returns the comma-separated host:port list for the connection URL.
+func (c *Connection) hostList() (string, error) {
+	if len(c.opts.hosts) == 0 {
+		return net.JoinHostPort(c.cfg.Host, strconv.Itoa(c.cfg.Port)), nil
+	}
+
+	hosts := make([]string, 0, len(c.opts.hosts))
+	for _, entry := range c.opts.hosts {
+		host, port := entry, c.cfg.Port
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 1 || n > 65535 {
+				return "", errors.NewValidationError(
+					fmt.Sprintf("invalid port in host %q", entry),
+					"hosts",
+				)
+			}
+			host, port = h, n
+		}
+
+		if strings.TrimSpace(host) == "" {
+			return "", errors.NewValidationError("host cannot be empty", "hosts")
+		}
+		hosts = append(hosts, net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+
+	return strings.Join(hosts, ","), nil
+}
+
+// validateTargetSessionAttrs rejects values libpq does not define.
+func validateTargetSessionAttrs(attrs TargetSessionAttrs) error {
+	switch attrs {
+	case "", TargetAny, TargetReadWrite, TargetReadOnly, TargetPrimary, TargetStandby, TargetPreferStandby:
+		return nil
+	default:
+		return errors.NewValidationError(
+			fmt.Sprintf("unknown target_session_attrs: %q", attrs),
+			"target_session_attrs",
+		)
+	}
+}
+
+// requiresWritable reports whether the Connection must land on a writable server.
+func (c *Connection) requiresWritable() bool {
+	return c.opts.targetSessionAttrs == TargetReadWrite || c.opts.targetSessionAttrs == TargetPrimary
+}
+
+// failoverTracer resets the pool when a statement fails because the server it
+// ran on is read-only, meaning the primary has moved.
+type failoverTracer struct {
+	conn      *Connection
+	lastReset atomic.Int64 // UnixNano of the last reset
+}
+
+var _ pgx.QueryTracer = (*failoverTracer)(nil)
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *failoverTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *failoverTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if SQLState(data.Err) != sqlStateReadOnlyTransaction {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := t.lastReset.Load()
+	if now-last < int64(failoverResetInterval) || !t.lastReset.CompareAndSwap(last, now) {
+		return
+	}
+
+	pool := t.conn.currentPool()
+	if pool == nil {
+		return
+	}
+
+	host := ""
+	if conn != nil {
+		host = remoteAddr(conn)
+	}
+	t.conn.events().log(
+		ctx,
+		LogEventFailoverDetected,
+		slog.LevelWarn,
+		"server is read-only, resetting pool to find the primary",
+		"host", host,
+	)
+
+	// Connections in use, including conn, are closed when released
+	pool.Reset()
+}
+
+// landedHost returns the address of the server a pooled connection is using.
+func landedHost(ctx context.Context, pool *pgxpool.Pool) string {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return ""
+	}
+	defer conn.Release()
+
+	return remoteAddr(conn.Conn())
+}
+
+// remoteAddr returns the server address of conn.
+func remoteAddr(conn *pgx.Conn) string {
+	netConn := conn.PgConn().Conn()
+	if netConn == nil {
+		return ""
+	}
+	return netConn.RemoteAddr().String()
+}
@@ -0,0 +1,89 @@
+package pgxutils
+
+import (
+	"testing"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostList(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts []string
+		want  string
+	}{
+		{"config host", nil, "localhost:5432"},
+		{"default port", []string{"pg1", "pg2"}, "pg1:5432,pg2:5432"},
+		{"explicit ports", []string{"pg1:5433", "pg2:5434"}, "pg1:5433,pg2:5434"},
+		{"ipv6", []string{"[::1]:5433", "::1"}, "[::1]:5433,[::1]:5432"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := NewConnection(baseConfig(), WithHosts(tt.hosts...))
+			require.NoError(t, err)
+
+			got, err := conn.hostList()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHostList_Invalid(t *testing.T) {
+	for _, hosts := range [][]string{{""}, {"pg1:0"}, {"pg1:notaport"}, {":5432"}} {
+		conn, err := NewConnection(baseConfig(), WithHosts(hosts...))
+		require.NoError(t, err)
+
+		_, err = conn.hostList()
+		require.Error(t, err, "hosts %q", hosts)
+		assert.True(t, errors.IsValidation(err))
+	}
+}
+
+func TestBuildPoolConfig_MultiHost(t *testing.T) {
+	conn, err := NewConnection(baseConfig(),
+		WithHosts("pg1:5433", "pg2:5434"),
+		WithTargetSessionAttrs(TargetReadWrite),
+	)
+	require.NoError(t, err)
+
+	poolConfig, err := conn.buildPoolConfig()
+	require.NoError(t, err)
+
+	cc := poolConfig.ConnConfig
+	assert.Equal(t, "pg1", cc.Host)
+	assert.Equal(t, uint16(5433), cc.Port)
+	require.Len(t, cc.Fallbacks, 1)
+	assert.Equal(t, "pg2", cc.Fallbacks[0].Host)
+	assert.Equal(t, uint16(5434), cc.Fallbacks[0].Port)
+	assert.NotNil(t, cc.ValidateConnect)
+	assert.NotNil(t, cc.Tracer, "read-write target installs the failover tracer")
+}
+
+func TestBuildPoolConfig_UnknownTargetSessionAttrs(t *testing.T) {
+	conn, err := NewConnection(baseConfig(), WithTargetSessionAttrs("leader"))
+	require.NoError(t, err)
+
+	_, err = conn.buildPoolConfig()
+	require.Error(t, err)
+	assert.True(t, errors.IsValidation(err))
+}
+
+func TestRequiresWritable(t *testing.T) {
+	for attrs, want := range map[TargetSessionAttrs]bool{
+		"":                  false,
+		TargetAny:           false,
+		TargetReadWrite:     true,
+		TargetPrimary:       true,
+		TargetReadOnly:      false,
+		TargetStandby:       false,
+		TargetPreferStandby: false,
+	} {
+		conn, err := NewConnection(baseConfig(), WithTargetSessionAttrs(attrs))
+		require.NoError(t, err)
+		assert.Equal(t, want, conn.requiresWritable(), "attrs %q", attrs)
+	}
+}
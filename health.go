@@ -2,19 +2,54 @@ package pgxutils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 )
 
 // HealthStatus represents the health status of the database
 type HealthStatus struct {
-	Healthy     bool          `json:"healthy"`
-	Message     string        `json:"message"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message"`
+	// Latency is serialized in milliseconds.
 	Latency     time.Duration `json:"latency_ms"`
 	Connections int32         `json:"connections"`
 	IdleConns   int32         `json:"idle_connections"`
 	MaxConns    int32         `json:"max_connections"`
 	LastChecked time.Time     `json:"last_checked"`
+
+	// PoolViolations lists the pool thresholds broken, set by health checks
+	// that include CheckPool.
+	PoolViolations []PoolViolation `json:"pool_violations,omitempty"`
+
+	// Replicas is set by Cluster.DetailedHealth.
+	Replicas []ReplicaStatus `json:"replicas,omitempty"`
+}
+
+// MarshalJSON encodes Latency as fractional milliseconds, as its name says.
+func (s HealthStatus) MarshalJSON() ([]byte, error) {
+	type plain HealthStatus
+	return json.Marshal(struct {
+		plain
+		Latency float64 `json:"latency_ms"`
+	}{
+		plain:   plain(s),
+		Latency: float64(s.Latency) / float64(time.Millisecond),
+	})
+}
+
+// UnmarshalJSON decodes the form written by MarshalJSON.
+func (s *HealthStatus) UnmarshalJSON(data []byte) error {
+	type plain HealthStatus
+	aux := struct {
+		*plain
+		Latency float64 `json:"latency_ms"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	s.Latency = time.Duration(aux.Latency * float64(time.Millisecond))
+	return nil
 }
 
 // DetailedHealth performs a comprehensive health check and returns detailed status
@@ -23,13 +58,14 @@ func (db *Connection) DetailedHealth(ctx context.Context) *HealthStatus {
 		LastChecked: time.Now(),
 	}
 
-	if db.pool == nil {
+	pool := db.currentPool()
+	if pool == nil {
 		status.Healthy = false
-		status.Message = "database pool not initialized"
+		status.Message = db.notConnectedError().Error()
 		return status
 	}
 
-	stats := db.pool.Stat()
+	stats := pool.Stat()
 	status.Connections = stats.AcquiredConns()
 	status.IdleConns = stats.IdleConns()
 	status.MaxConns = stats.MaxConns()
@@ -40,7 +76,7 @@ func (db *Connection) DetailedHealth(ctx context.Context) *HealthStatus {
 
 	if err != nil {
 		status.Healthy = false
-		status.Message = fmt.Sprintf("health check failed: %v", err)
+		status.Message = fmt.Sprintf("health check failed: %v", redactError(err, db.secrets()...))
 	} else {
 		status.Healthy = true
 		status.Message = "database is healthy"
@@ -76,23 +112,13 @@ func (db *Connection) IsHealthy(ctx context.Context) bool {
 	return db.Health(ctx) == nil
 }
 
-// CheckConnections verifies that the connection pool is within healthy thresholds
+// CheckConnections verifies that the connection pool is within the thresholds
+// set by WithPoolThresholds, returning an error for critical violations only.
+// By default that is an exhausted pool. Use CheckPool for warnings too.
 func (db *Connection) CheckConnections() error {
-	if db.pool == nil {
-		return fmt.Errorf("database pool not initialized")
-	}
-
-	stats := db.pool.Stat()
-
-	if stats.AcquiredConns() >= stats.MaxConns() {
-		return fmt.Errorf("connection pool exhausted: %d/%d connections in use",
-			stats.AcquiredConns(), stats.MaxConns())
-	}
-
-	idleRatio := float64(stats.IdleConns()) / float64(stats.MaxConns())
-	if idleRatio > 0.9 {
-		return fmt.Errorf("high idle connection ratio: %.2f%% idle", idleRatio*100)
+	check, err := db.CheckPool()
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return check.Err()
 }
@@ -0,0 +1,189 @@
+package pgxutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+)
+
+// HealthReport is the JSON body served by HealthHandler.
+type HealthReport struct {
+	// Healthy is set when every connection is.
+	Healthy     bool                        `json:"healthy"`
+	Connections map[string]ConnectionHealth `json:"connections"`
+}
+
+// ConnectionHealth is the health of one named Connection in a HealthReport.
+type ConnectionHealth struct {
+	Status HealthStatus `json:"status"`
+	// Pool is only reported with ?verbose.
+	Pool *PoolMetrics `json:"pool,omitempty"`
+}
+
+// HealthHandler serves liveness and readiness probes for one or more named
+// Connections.
+type HealthHandler struct {
+	names []string
+	conns map[string]*Connection
+}
+
+// NewHealthHandler creates a HealthHandler reporting on conns by name.
+//
+// Example usage:
+//
+//	health, err := pgxutils.NewHealthHandler(map[string]*pgxutils.Connection{
+//	    "primary":   primary,
+//	    "analytics": analytics,
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	health.Register(mux) // serves /livez and /readyz
+func NewHealthHandler(conns map[string]*Connection) (*HealthHandler, error) {
+	if len(conns) == 0 {
+		return nil, errors.NewValidationError("at least one connection is required", "connections")
+	}
+
+	h := &HealthHandler{conns: make(map[string]*Connection, len(conns))}
+	for name, conn := range conns {
+		if conn == nil {
+			return nil, errors.NewValidationError(fmt.Sprintf("connection %q cannot be nil", name), "connections")
+		}
+		h.names = append(h.names, name)
+		h.conns[name] = conn
+	}
+	sort.Strings(h.names)
+	return h, nil
+}
+
+// Register serves Liveness at /livez and Readiness at /readyz on mux.
+func (h *HealthHandler) Register(mux *http.ServeMux) {
+	mux.Handle("/livez", h.Liveness())
+	mux.Handle("/readyz", h.Readiness())
+}
+
+// Liveness returns a handler that reports, without querying the database,
+// whether each Connection can still serve. It fails only when a pool is gone
+// and no background connect is bringing one up: before Connect, after Close
+// or Shutdown, or once ConnectAsync has given up. An unreachable database does
+// not fail liveness, since restarting the process would not fix it.
+func (h *HealthHandler) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, func(_ context.Context, conn *Connection) HealthStatus {
+			return conn.liveness()
+		})
+	})
+}
+
+// Readiness returns a handler that reports whether each Connection can take
+// traffic: it must pass DetailedHealth and CheckConnections.
+//
+// While a HealthMonitor started with StartHealthMonitor runs, its cached result
+// and debounced state are served instead of checking again.
+func (h *HealthHandler) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, func(ctx context.Context, conn *Connection) HealthStatus {
+			return conn.readiness(ctx)
+		})
+	})
+}
+
+// serve checks every connection concurrently and writes the report, with
+// status 503 unless all are healthy. With ?verbose, pool metrics are included.
+func (h *HealthHandler) serve(w http.ResponseWriter, r *http.Request, check func(context.Context, *Connection) HealthStatus) {
+	verbose := isVerbose(r)
+
+	results := make([]ConnectionHealth, len(h.names))
+	var wg sync.WaitGroup
+	for i, name := range h.names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn := h.conns[name]
+			results[i] = ConnectionHealth{Status: check(r.Context(), conn)}
+			if verbose {
+				results[i].Pool = conn.GetMetrics()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := HealthReport{
+		Healthy:     true,
+		Connections: make(map[string]ConnectionHealth, len(h.names)),
+	}
+	for i, name := range h.names {
+		report.Connections[name] = results[i]
+		report.Healthy = report.Healthy && results[i].Status.Healthy
+	}
+
+	code := http.StatusOK
+	if !report.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// isVerbose reports whether the request asks for ?verbose. A bare ?verbose or
+// any true value given to it counts.
+func isVerbose(r *http.Request) bool {
+	values, ok := r.URL.Query()["verbose"]
+	if !ok {
+		return false
+	}
+	if len(values) == 0 || values[0] == "" {
+		return true
+	}
+	verbose, err := strconv.ParseBool(values[0])
+	return err == nil && verbose
+}
+
+// liveness reports whether the connection has a pool, or is still connecting
+// to get one.
+func (c *Connection) liveness() HealthStatus {
+	status := HealthStatus{LastChecked: time.Now()}
+
+	if pool := c.currentPool(); pool != nil {
+		stats := pool.Stat()
+		status.Healthy = true
+		status.Message = "database pool open"
+		status.Connections = stats.AcquiredConns()
+		status.IdleConns = stats.IdleConns()
+		status.MaxConns = stats.MaxConns()
+		return status
+	}
+
+	if bg := c.connecting.Load(); bg != nil && !bg.finished() && !c.shuttingDown.Load() {
+		status.Healthy = true
+		status.Message = "connecting in the background"
+		return status
+	}
+
+	status.Message = redactError(c.notConnectedError(), c.secrets()...).Error()
+	return status
+}
+
+// readiness reports whether the connection can take traffic, from the running
+// HealthMonitor if there is one.
+func (c *Connection) readiness(ctx context.Context) HealthStatus {
+	if m := c.monitor.Load(); m != nil {
+		if status := m.Status(); status != nil {
+			status.Healthy = m.Healthy()
+			return *status
+		}
+	}
+
+	return *c.checkHealth(ctx)
+}
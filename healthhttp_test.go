@@ -0,0 +1,204 @@
+package pgxutils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthStatus_LatencyInMilliseconds(t *testing.T) {
+	status := HealthStatus{Healthy: true, Message: "ok", Latency: 1500 * time.Microsecond}
+
+	data, err := json.Marshal(status)
+	require.NoError(t, err)
+
+	var raw map[string]any
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.InDelta(t, 1.5, raw["latency_ms"], 1e-9)
+	assert.Equal(t, "ok", raw["message"])
+
+	var decoded HealthStatus
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, status.Latency, decoded.Latency)
+	assert.True(t, decoded.Healthy)
+}
+
+func TestPoolMetrics_AcquireTimeInMilliseconds(t *testing.T) {
+	metrics := PoolMetrics{MaxConns: 4, TotalAcquireTime: 2500 * time.Microsecond}
+
+	data, err := json.Marshal(metrics)
+	require.NoError(t, err)
+
+	var raw map[string]any
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.InDelta(t, 2.5, raw["total_acquire_time_ms"], 1e-9)
+	assert.EqualValues(t, 2500*time.Microsecond, raw["total_acquire_time"], "the deprecated key keeps integer nanoseconds")
+	assert.EqualValues(t, 4, raw["max_connections"])
+
+	var decoded PoolMetrics
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, metrics, decoded)
+}
+
+func TestPoolMetrics_DecodesNanosecondKey(t *testing.T) {
+	var decoded PoolMetrics
+	require.NoError(t, json.Unmarshal([]byte(`{"max_connections":4,"total_acquire_time":2500000}`), &decoded))
+	assert.Equal(t, PoolMetrics{MaxConns: 4, TotalAcquireTime: 2500 * time.Microsecond}, decoded)
+}
+
+func TestReplicaStatus_LagInMilliseconds(t *testing.T) {
+	status := HealthStatus{Replicas: []ReplicaStatus{{
+		Host:           "replica:5432",
+		InRotation:     true,
+		ReplicationLag: 1250 * time.Millisecond,
+		LagKnown:       true,
+	}}}
+
+	data, err := json.Marshal(status)
+	require.NoError(t, err)
+
+	var raw struct {
+		Replicas []map[string]any `json:"replicas"`
+	}
+	require.NoError(t, json.Unmarshal(data, &raw))
+	require.Len(t, raw.Replicas, 1)
+	assert.InDelta(t, 1250.0, raw.Replicas[0]["replication_lag_ms"], 1e-9)
+	assert.NotContains(t, raw.Replicas[0], "replication_lag")
+	assert.Equal(t, "replica:5432", raw.Replicas[0]["host"])
+
+	var decoded HealthStatus
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, status.Replicas, decoded.Replicas)
+}
+
+func TestNewHealthHandler_Validation(t *testing.T) {
+	_, err := NewHealthHandler(nil)
+	assert.Error(t, err)
+
+	_, err = NewHealthHandler(map[string]*Connection{"db": nil})
+	assert.Error(t, err)
+}
+
+// probe serves a request to handler and decodes the report.
+func probe(t *testing.T, handler http.Handler, target string) (int, HealthReport) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var report HealthReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return rec.Code, report
+}
+
+func TestHealthHandler_Liveness(t *testing.T) {
+	connected := unreachableConnection(t)
+	connected.pool.Store(newPoolHandle(lazyPool(t, connected), &connRegistry{}))
+	defer connected.Close()
+
+	connecting := unreachableConnection(t, WithConnectRetryPolicy(ConnectRetryPolicy{InitialDelay: time.Minute, MaxDelay: time.Minute}))
+	require.NoError(t, connecting.ConnectAsync(context.Background()))
+	defer connecting.Close()
+
+	health, err := NewHealthHandler(map[string]*Connection{"main": connected, "lazy": connecting})
+	require.NoError(t, err)
+
+	// Neither check reaches the database
+	code, report := probe(t, health.Liveness(), "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Healthy)
+	assert.Equal(t, "database pool open", report.Connections["main"].Status.Message)
+	assert.Equal(t, "connecting in the background", report.Connections["lazy"].Status.Message)
+	assert.Nil(t, report.Connections["main"].Pool)
+
+	connected.Close()
+	code, report = probe(t, health.Liveness(), "/livez")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Healthy)
+	assert.False(t, report.Connections["main"].Status.Healthy)
+	assert.True(t, report.Connections["lazy"].Status.Healthy)
+}
+
+func TestHealthHandler_ReadinessUsesMonitor(t *testing.T) {
+	healthy := unreachableConnection(t)
+	m := newTestMonitor(10, 1, 1)
+	m.record(HealthStatus{Healthy: true, Message: "database is healthy", Latency: 2 * time.Millisecond, MaxConns: 4})
+	healthy.monitor.Store(m)
+
+	down := unreachableConnection(t)
+
+	health, err := NewHealthHandler(map[string]*Connection{"primary": healthy, "reporting": down})
+	require.NoError(t, err)
+
+	code, report := probe(t, health.Readiness(), "/readyz?verbose")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Healthy)
+
+	primary := report.Connections["primary"]
+	assert.True(t, primary.Status.Healthy)
+	assert.Equal(t, 2*time.Millisecond, primary.Status.Latency)
+	require.NotNil(t, primary.Pool, "verbose reports pool metrics")
+
+	reporting := report.Connections["reporting"]
+	assert.False(t, reporting.Status.Healthy)
+	assert.Contains(t, reporting.Status.Message, "database pool not initialized")
+
+}
+
+func TestHealthHandler_ReadinessIsDebounced(t *testing.T) {
+	conn := unreachableConnection(t)
+	m := newTestMonitor(10, 2, 1)
+	m.record(HealthStatus{Healthy: true})
+	m.record(HealthStatus{Healthy: false, Message: "blip"})
+	conn.monitor.Store(m)
+
+	health, err := NewHealthHandler(map[string]*Connection{"primary": conn})
+	require.NoError(t, err)
+
+	// A single failure does not fail readiness, but is reported
+	code, report := probe(t, health.Readiness(), "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "blip", report.Connections["primary"].Status.Message)
+
+	m.record(HealthStatus{Healthy: false, Message: "down"})
+	code, _ = probe(t, health.Readiness(), "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestHealthHandler_Register(t *testing.T) {
+	conn := unreachableConnection(t)
+	health, err := NewHealthHandler(map[string]*Connection{"db": conn})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	health.Register(mux)
+
+	for _, path := range []string{"/livez", "/readyz"} {
+		code, report := probe(t, mux, path)
+		assert.Equal(t, http.StatusServiceUnavailable, code, path)
+		assert.Contains(t, report.Connections, "db", path)
+	}
+}
+
+func TestIsVerbose(t *testing.T) {
+	tests := map[string]bool{
+		"/readyz":               false,
+		"/readyz?verbose":       true,
+		"/readyz?verbose=":      true,
+		"/readyz?verbose=1":     true,
+		"/readyz?verbose=true":  true,
+		"/readyz?verbose=false": false,
+		"/readyz?verbose=0":     false,
+		"/readyz?verbose=maybe": false,
+	}
+	for target, want := range tests {
+		assert.Equal(t, want, isVerbose(httptest.NewRequest(http.MethodGet, target, nil)), target)
+	}
+}
@@ -0,0 +1,303 @@
+package pgxutils
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+)
+
+// LogEventHealthChanged is logged when a HealthMonitor's state changes.
+const LogEventHealthChanged LogEvent = "health_changed"
+
+// HealthChange describes a change of the state tracked by a HealthMonitor.
+type HealthChange struct {
+	// Healthy is the new state.
+	Healthy bool
+	// Status is the check that completed the change.
+	Status HealthStatus
+	// Initial is set for the first check, which establishes the state, and
+	// for the current state delivered to a new subscriber.
+	Initial bool
+}
+
+// HealthMonitorOption is a functional option for configuring StartHealthMonitor.
+type HealthMonitorOption func(*healthMonitorOptions)
+
+// healthMonitorOptions holds optional configuration for StartHealthMonitor.
+type healthMonitorOptions struct {
+	history        int
+	unhealthyAfter int
+	healthyAfter   int
+}
+
+// WithHealthHistory sets how many recent results a HealthMonitor keeps.
+// Default is 10.
+func WithHealthHistory(n int) HealthMonitorOption {
+	return func(opts *healthMonitorOptions) {
+		opts.history = n
+	}
+}
+
+// WithHealthThresholds sets how many consecutive failed checks turn a healthy
+// monitor unhealthy, and how many consecutive passing checks turn it healthy
+// again, so that a flapping database does not flap its subscribers.
+// Default is 3 and 2.
+func WithHealthThresholds(unhealthyAfter, healthyAfter int) HealthMonitorOption {
+	return func(opts *healthMonitorOptions) {
+		opts.unhealthyAfter = unhealthyAfter
+		opts.healthyAfter = healthyAfter
+	}
+}
+
+// HealthMonitor checks a Connection's health in the background and caches the
+// results. Create one with StartHealthMonitor.
+type HealthMonitor struct {
+	conn *Connection
+	opts healthMonitorOptions
+
+	mu          sync.RWMutex
+	history     []HealthStatus // oldest first
+	checked     bool
+	healthy     bool
+	streak      int // consecutive results disagreeing with healthy
+	subscribers map[int]func(HealthChange)
+	nextID      int
+
+	// notifyMu serializes deliveries to subscribers, so a new subscriber's
+	// initial state is never overtaken or repeated by a change
+	notifyMu sync.Mutex
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartHealthMonitor checks health every interval until ctx is done or Stop is
+// called, starting straight away.
+//
+// Each check runs DetailedHealth and CheckConnections; a check passes when
+// both do. The monitor's state changes only after the number of consecutive
+// results set by WithHealthThresholds, and subscribers are told of each change.
+// Status, Healthy and History read the cached results without querying the
+// database, as does the readiness handler of a HealthHandler while the
+// monitor runs.
+//
+// Example usage:
+//
+//	monitor, err := conn.StartHealthMonitor(ctx, 10*time.Second)
+//	if err != nil {
+//	    return err
+//	}
+//	defer monitor.Stop()
+//	monitor.Subscribe(func(change pgxutils.HealthChange) {
+//	    breaker.SetOpen(!change.Healthy)
+//	})
+func (c *Connection) StartHealthMonitor(ctx context.Context, interval time.Duration, opts ...HealthMonitorOption) (*HealthMonitor, error) {
+	if interval <= 0 {
+		return nil, errors.NewValidationError("health monitor interval must be positive", "interval")
+	}
+
+	o := healthMonitorOptions{
+		history:        10,
+		unhealthyAfter: 3,
+		healthyAfter:   2,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	o.history = max(o.history, 1)
+	o.unhealthyAfter = max(o.unhealthyAfter, 1)
+	o.healthyAfter = max(o.healthyAfter, 1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	m := &HealthMonitor{
+		conn:        c,
+		opts:        o,
+		subscribers: make(map[int]func(HealthChange)),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	c.monitor.Store(m)
+	go func() {
+		defer close(m.done)
+		defer c.monitor.CompareAndSwap(m, nil)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			m.check(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return m, nil
+}
+
+// Stop stops the monitor and waits for a running check to finish.
+func (m *HealthMonitor) Stop() {
+	m.cancel()
+	<-m.done
+}
+
+// Subscribe registers fn to be called on every change of state, from the
+// monitor's goroutine. If a check has already completed, fn is first called
+// with the current state, marked Initial, before Subscribe returns. fn must not
+// call Subscribe. The returned function unsubscribes it.
+func (m *HealthMonitor) Subscribe(fn func(HealthChange)) (unsubscribe func()) {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	m.subscribers[id] = fn
+	current, checked := HealthChange{Healthy: m.healthy, Initial: true}, m.checked
+	if checked {
+		current.Status = m.history[len(m.history)-1]
+	}
+	m.mu.Unlock()
+
+	if checked {
+		fn(current)
+	}
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.subscribers, id)
+	}
+}
+
+// Healthy returns the debounced state: false until the first check passes.
+func (m *HealthMonitor) Healthy() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.healthy
+}
+
+// Status returns the most recent result, or nil before the first check has
+// finished. Its Healthy field is that check's own result, which may differ
+// from the debounced Healthy.
+func (m *HealthMonitor) Status() *HealthStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.history) == 0 {
+		return nil
+	}
+	status := m.history[len(m.history)-1]
+	return &status
+}
+
+// History returns the recent results, oldest first.
+func (m *HealthMonitor) History() []HealthStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]HealthStatus(nil), m.history...)
+}
+
+// check runs one health check and records its result.
+func (m *HealthMonitor) check(ctx context.Context) {
+	status := m.conn.checkHealth(ctx)
+	if ctx.Err() != nil {
+		// Stopped mid-check; the failure says nothing about the database
+		return
+	}
+
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	if change, changed := m.record(*status); changed {
+		m.notify(ctx, change)
+	}
+}
+
+// record adds a result to the history and applies it to the debounced state,
+// returning the change it caused, if any.
+func (m *HealthMonitor) record(status HealthStatus) (HealthChange, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.history = append(m.history, status)
+	if len(m.history) > m.opts.history {
+		m.history = m.history[len(m.history)-m.opts.history:]
+	}
+
+	if !m.checked {
+		m.checked = true
+		m.healthy = status.Healthy
+		return HealthChange{Healthy: status.Healthy, Status: status, Initial: true}, true
+	}
+
+	if status.Healthy == m.healthy {
+		m.streak = 0
+		return HealthChange{}, false
+	}
+
+	m.streak++
+	needed := m.opts.unhealthyAfter
+	if !m.healthy {
+		needed = m.opts.healthyAfter
+	}
+	if m.streak < needed {
+		return HealthChange{}, false
+	}
+
+	m.healthy = status.Healthy
+	m.streak = 0
+	return HealthChange{Healthy: status.Healthy, Status: status}, true
+}
+
+// checkHealth runs DetailedHealth and, if that passes, CheckPool, failing on
+// critical violations and reporting the rest.
+func (c *Connection) checkHealth(ctx context.Context) *HealthStatus {
+	status := c.DetailedHealth(ctx)
+	if !status.Healthy {
+		return status
+	}
+
+	check, err := c.CheckPool()
+	if err != nil {
+		status.Healthy = false
+		status.Message = err.Error()
+		return status
+	}
+	status.PoolViolations = check.Violations
+	if err := check.Err(); err != nil {
+		status.Healthy = false
+		status.Message = err.Error()
+	}
+	return status
+}
+
+// notify logs a change and passes it to every subscriber.
+func (m *HealthMonitor) notify(ctx context.Context, change HealthChange) {
+	level, msg := slog.LevelInfo, "database became healthy"
+	if !change.Healthy {
+		level, msg = slog.LevelWarn, "database became unhealthy"
+	}
+	m.conn.events().log(ctx, LogEventHealthChanged, level, msg,
+		"initial", change.Initial,
+		"message", change.Status.Message,
+	)
+
+	m.mu.RLock()
+	subscribers := make([]func(HealthChange), 0, len(m.subscribers))
+	for _, fn := range m.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	m.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(change)
+	}
+}
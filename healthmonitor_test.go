@@ -0,0 +1,154 @@
+package pgxutils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMonitor(history, unhealthyAfter, healthyAfter int) *HealthMonitor {
+	return &HealthMonitor{
+		opts: healthMonitorOptions{
+			history:        history,
+			unhealthyAfter: unhealthyAfter,
+			healthyAfter:   healthyAfter,
+		},
+		subscribers: make(map[int]func(HealthChange)),
+	}
+}
+
+func TestHealthMonitor_Debounce(t *testing.T) {
+	m := newTestMonitor(10, 3, 2)
+
+	// results and whether each should change the state
+	steps := []struct {
+		healthy bool
+		changed bool
+	}{
+		{true, true}, // the first result sets the state
+		{false, false},
+		{false, false},
+		{true, false}, // a pass resets the failure streak
+		{false, false},
+		{false, false},
+		{false, true}, // third consecutive failure
+		{true, false},
+		{false, false},
+		{true, false},
+		{true, true}, // second consecutive pass
+	}
+	for i, step := range steps {
+		change, changed := m.record(HealthStatus{Healthy: step.healthy})
+		require.Equal(t, step.changed, changed, "step %d", i)
+		if changed {
+			assert.Equal(t, step.healthy, change.Healthy, "step %d", i)
+			assert.Equal(t, i == 0, change.Initial, "step %d", i)
+		}
+	}
+	assert.True(t, m.Healthy())
+}
+
+func TestHealthMonitor_HistoryIsBounded(t *testing.T) {
+	m := newTestMonitor(3, 1, 1)
+	assert.Nil(t, m.Status())
+
+	for i := range 5 {
+		m.record(HealthStatus{Message: string(rune('a' + i))})
+	}
+
+	history := m.History()
+	require.Len(t, history, 3)
+	assert.Equal(t, "c", history[0].Message)
+	assert.Equal(t, "e", history[2].Message)
+	assert.Equal(t, "e", m.Status().Message)
+
+	// Callers get copies
+	m.Status().Message = "changed"
+	history[2].Message = "changed"
+	assert.Equal(t, "e", m.Status().Message)
+}
+
+func TestHealthMonitor_InvalidInterval(t *testing.T) {
+	conn := unreachableConnection(t)
+	_, err := conn.StartHealthMonitor(context.Background(), 0)
+	assert.Error(t, err)
+}
+
+func TestHealthMonitor_ReportsUnhealthyConnection(t *testing.T) {
+	conn := unreachableConnection(t)
+
+	var (
+		mu      sync.Mutex
+		changes []HealthChange
+	)
+	monitor, err := conn.StartHealthMonitor(context.Background(), 10*time.Millisecond, WithHealthHistory(2))
+	require.NoError(t, err)
+	unsubscribe := monitor.Subscribe(func(change HealthChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, change)
+	})
+
+	require.Eventually(t, func() bool { return len(monitor.History()) == 2 }, time.Second, 5*time.Millisecond)
+	monitor.Stop()
+	unsubscribe()
+
+	assert.False(t, monitor.Healthy())
+	status := monitor.Status()
+	require.NotNil(t, status)
+	assert.False(t, status.Healthy)
+	assert.Contains(t, status.Message, "database pool not initialized")
+
+	// Stop is final: no further checks are recorded
+	last := monitor.History()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, last, monitor.History())
+
+	// The subscriber hears the initial state once, whether it subscribed
+	// before or after the first check, and no change while it stays unhealthy
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, changes, 1)
+	assert.True(t, changes[0].Initial)
+	assert.False(t, changes[0].Healthy)
+}
+
+func TestHealthMonitor_SubscribeAfterFirstCheck(t *testing.T) {
+	conn := unreachableConnection(t)
+
+	monitor, err := conn.StartHealthMonitor(context.Background(), time.Hour)
+	require.NoError(t, err)
+	defer monitor.Stop()
+	require.Eventually(t, func() bool { return monitor.Status() != nil }, time.Second, 5*time.Millisecond)
+
+	var changes []HealthChange
+	unsubscribe := monitor.Subscribe(func(change HealthChange) {
+		changes = append(changes, change)
+	})
+	defer unsubscribe()
+
+	require.Len(t, changes, 1, "the current state is delivered before Subscribe returns")
+	assert.True(t, changes[0].Initial)
+	assert.False(t, changes[0].Healthy)
+	assert.Equal(t, *monitor.Status(), changes[0].Status)
+}
+
+func TestHealthMonitor_StopsWithContext(t *testing.T) {
+	conn := unreachableConnection(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	monitor, err := conn.StartHealthMonitor(ctx, time.Hour)
+	require.NoError(t, err)
+	cancel()
+
+	select {
+	case <-monitor.done:
+	case <-time.After(time.Second):
+		t.Fatal("monitor kept running after its context was done")
+	}
+	monitor.Stop()
+}
@@ -4,12 +4,25 @@ package pgxutils
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/JohnPlummer/jp-go-config"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
@@ -415,6 +428,164 @@ func TestIntegration_Connection_RetryOnFailure(t *testing.T) {
 	assert.LessOrEqual(t, duration, 7*time.Second) // Allow some overhead
 }
 
+func TestIntegration_Connection_AbortsOnBadPassword(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	cfg.Password = "wrong"
+
+	attempts := 0
+	conn, err := NewConnection(cfg,
+		WithRetryTimeout(30*time.Second),
+		WithConnectRetryPolicy(ConnectRetryPolicy{
+			OnAttempt: func(int, error, time.Duration) { attempts++ },
+		}),
+	)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = conn.Connect(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, "28P01", SQLState(err))
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.NotContains(t, err.Error(), "wrong")
+}
+
+func TestIntegration_Connection_ConnectAsync(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	ctx := context.Background()
+
+	conn, err := NewConnection(cfg, WithLazyConnect(), WithWaitForConnect())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.Connect(ctx))
+
+	// Calls made straight away wait for the background connect
+	var one int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT 1").Scan(&one))
+	assert.Equal(t, 1, one)
+
+	select {
+	case <-conn.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ready not closed after connecting")
+	}
+	assert.NoError(t, conn.Health(ctx))
+}
+
+func TestIntegration_Connection_HealthMonitor(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	ctx := context.Background()
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(ctx))
+	defer conn.Close()
+
+	monitor, err := conn.StartHealthMonitor(ctx, 20*time.Millisecond, WithHealthThresholds(1, 1))
+	require.NoError(t, err)
+	defer monitor.Stop()
+
+	changes := make(chan HealthChange, 10)
+	monitor.Subscribe(func(change HealthChange) { changes <- change })
+
+	require.Eventually(t, monitor.Healthy, 5*time.Second, 10*time.Millisecond)
+	status := monitor.Status()
+	require.NotNil(t, status)
+	assert.True(t, status.Healthy)
+	assert.Positive(t, status.MaxConns)
+
+	// Losing the pool is reported to subscribers, who may also have seen the
+	// initial healthy result
+	conn.Close()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case change := <-changes:
+			if change.Healthy {
+				assert.True(t, change.Initial)
+				continue
+			}
+			assert.False(t, monitor.Healthy())
+			return
+		case <-timeout:
+			t.Fatal("no unhealthy change reported")
+		}
+	}
+}
+
+func TestIntegration_HealthHandler_Readiness(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	ctx := context.Background()
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(ctx))
+	defer conn.Close()
+
+	health, err := NewHealthHandler(map[string]*Connection{"primary": conn})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	health.Readiness().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz?verbose", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var body struct {
+		Healthy     bool `json:"healthy"`
+		Connections map[string]struct {
+			Status struct {
+				Healthy   bool    `json:"healthy"`
+				LatencyMS float64 `json:"latency_ms"`
+			} `json:"status"`
+			Pool *PoolMetrics `json:"pool"`
+		} `json:"connections"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.True(t, body.Healthy)
+
+	primary := body.Connections["primary"]
+	assert.True(t, primary.Status.Healthy)
+	assert.Positive(t, primary.Status.LatencyMS)
+	assert.Less(t, primary.Status.LatencyMS, 5000.0, "latency is reported in milliseconds")
+	require.NotNil(t, primary.Pool)
+	assert.EqualValues(t, cfg.MaxConns, primary.Pool.MaxConns)
+}
+
+func TestIntegration_Connection_PoolThresholds(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	ctx := context.Background()
+
+	cfg.MaxConns = 2
+	conn, err := NewConnection(cfg, WithPoolThresholds(PoolThresholds{MaxUtilization: 0.5}))
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(ctx))
+	defer conn.Close()
+
+	first, err := conn.Pool().Acquire(ctx)
+	require.NoError(t, err)
+	defer first.Release()
+
+	// Half the pool in use is a warning, which does not fail health
+	status := conn.checkHealth(ctx)
+	assert.True(t, status.Healthy, status.Message)
+	require.Len(t, status.PoolViolations, 1)
+	assert.Equal(t, PoolRuleUtilization, status.PoolViolations[0].Rule)
+	assert.Equal(t, SeverityWarning, status.PoolViolations[0].Severity)
+	assert.NoError(t, conn.CheckConnections())
+
+	second, err := conn.Pool().Acquire(ctx)
+	require.NoError(t, err)
+	defer second.Release()
+
+	// An exhausted pool is critical
+	check, err := conn.CheckPool()
+	require.NoError(t, err)
+	require.Len(t, check.Violations, 1)
+	assert.Equal(t, SeverityCritical, check.Violations[0].Severity)
+	assert.False(t, check.Healthy())
+	assert.ErrorContains(t, conn.CheckConnections(), "connection pool exhausted: 2/2")
+}
+
 func TestIntegration_Connection_CustomHealthTimeout(t *testing.T) {
 	_, cfg := setupTestContainer(t)
 
@@ -469,3 +640,708 @@ func TestIntegration_Connection_BeginTx(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, 1, count)
 }
+
+func TestIntegration_WithRetryableTransaction_RetriesSerializationFailure(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	err = conn.Connect(ctx)
+	require.NoError(t, err)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE test_retry (
+			id SERIAL PRIMARY KEY,
+			value TEXT NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+
+	attempts := 0
+	retries := 0
+	err = conn.WithRetryableTransaction(ctx, func(tx pgx.Tx) error {
+		attempts++
+		if _, err := tx.Exec(ctx, "INSERT INTO test_retry (value) VALUES ($1)", "row"); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			// Raise a genuine serialization_failure from the server
+			_, err := tx.Exec(ctx, "DO $$ BEGIN RAISE EXCEPTION USING ERRCODE = 'serialization_failure'; END $$")
+			return err
+		}
+		return nil
+	}, WithTxBackoff(time.Millisecond, 10*time.Millisecond), WithTxRetryHook(func(int, error, time.Duration) {
+		retries++
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 1, retries)
+
+	// Only the successful attempt's insert is committed
+	var count int
+	err = conn.QueryRow(ctx, "SELECT COUNT(*) FROM test_retry").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestIntegration_WithTransactionOptions_ReadOnly(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	err = conn.Connect(ctx)
+	require.NoError(t, err)
+
+	_, err = conn.Exec(ctx, "CREATE TABLE test_readonly (id SERIAL PRIMARY KEY)")
+	require.NoError(t, err)
+
+	txOptions := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+
+	var isolation string
+	err = WithTransactionOptions(ctx, conn, nil, txOptions, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SHOW transaction_isolation").Scan(&isolation)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "repeatable read", isolation)
+
+	// Writes are rejected in a read-only transaction
+	err = conn.WithTransactionOptions(ctx, txOptions, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO test_readonly DEFAULT VALUES")
+		return err
+	})
+	require.Error(t, err)
+	assert.Equal(t, "25006", SQLState(err)) // read_only_sql_transaction
+}
+
+func TestIntegration_WithTransactionContext_NestedSavepoint(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	err = conn.Connect(ctx)
+	require.NoError(t, err)
+
+	_, err = conn.Exec(ctx, "CREATE TABLE test_nested (name TEXT PRIMARY KEY)")
+	require.NoError(t, err)
+
+	insert := func(ctx context.Context, name string) error {
+		_, err := conn.FromContext(ctx).Exec(ctx, "INSERT INTO test_nested (name) VALUES ($1)", name)
+		return err
+	}
+
+	err = conn.WithTransactionContext(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if err := insert(ctx, "outer"); err != nil {
+			return err
+		}
+
+		// The nested transaction fails; only its savepoint is rolled back
+		nestedErr := WithTransactionContext(ctx, conn, nil, func(ctx context.Context, tx pgx.Tx) error {
+			if err := insert(ctx, "inner"); err != nil {
+				return err
+			}
+			return insert(ctx, "outer") // unique violation
+		})
+		require.Error(t, nestedErr)
+
+		// The outer transaction is still usable after the savepoint rollback
+		return conn.WithTransaction(ctx, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, "INSERT INTO test_nested (name) VALUES ($1)", "after")
+			return err
+		})
+	})
+	require.NoError(t, err)
+
+	rows, err := conn.Query(ctx, "SELECT name FROM test_nested ORDER BY name")
+	require.NoError(t, err)
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"after", "outer"}, names)
+}
+
+func TestIntegration_Querier_AllImplementations(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	err = conn.Connect(ctx)
+	require.NoError(t, err)
+
+	selectOne := func(q Querier) int {
+		var n int
+		require.NoError(t, q.QueryRow(ctx, "SELECT 1").Scan(&n))
+		return n
+	}
+
+	assert.Equal(t, 1, selectOne(conn))
+
+	cw, err := conn.Acquire(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, selectOne(cw))
+	cw.Release()
+
+	err = conn.WithTransaction(ctx, func(tx pgx.Tx) error {
+		assert.Equal(t, 1, selectOne(tx))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestIntegration_WithRetry_AcquireTimeout(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	cfg.MaxConns = 1
+	cfg.MinConns = 1
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	err = conn.Connect(ctx)
+	require.NoError(t, err)
+
+	attempts := 0
+	r := conn.WithRetry(
+		WithRetryMaxAttempts(2),
+		WithRetryBackoff(time.Millisecond, time.Millisecond),
+		WithRetryAcquireTimeout(50*time.Millisecond),
+		WithRetryHook(func(attempt int, err error, delay time.Duration) {
+			attempts = attempt
+		}),
+	)
+
+	var n int
+	require.NoError(t, r.QueryRow(ctx, "SELECT 1").Scan(&n))
+	assert.Equal(t, 1, n)
+
+	// Hold the only connection so every attempt times out acquiring
+	held, err := conn.Acquire(ctx)
+	require.NoError(t, err)
+
+	err = r.QueryRow(ctx, "SELECT 1").Scan(&n)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrAcquireTimeout))
+	assert.Equal(t, 1, attempts)
+
+	held.Release()
+
+	rows, err := r.Query(ctx, "SELECT generate_series(1, 3)")
+	require.NoError(t, err)
+	values, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+	require.NoError(t, err)
+	assert.Equal(t, []int32{1, 2, 3}, values)
+
+	// The connection used by Query was returned to the pool
+	_, err = r.Exec(ctx, "SELECT 1")
+	require.NoError(t, err)
+}
+
+func TestIntegration_Cluster_RoutesAndRotatesReplicas(t *testing.T) {
+	_, primaryCfg := setupTestContainer(t)
+	replicaContainer, replicaCfg := setupTestContainer(t)
+
+	primary, err := NewConnection(primaryCfg)
+	require.NoError(t, err)
+	replica, err := NewConnection(replicaCfg, WithHealthTimeout(time.Second))
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(primary, []*Connection{replica}, WithReplicaHealthInterval(0))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	ctx := context.Background()
+	require.NoError(t, cluster.Connect(ctx))
+	require.Eventually(t, func() bool {
+		return cluster.HealthyReplicas() == 1
+	}, 10*time.Second, 20*time.Millisecond, "the replica joins once it connects")
+
+	// Writes go to the primary, reads to the replica
+	_, err = cluster.Exec(ctx, "CREATE TABLE test_cluster (id INT)")
+	require.NoError(t, err)
+
+	var exists bool
+	err = cluster.QueryRow(ctx, "SELECT to_regclass('test_cluster') IS NOT NULL").Scan(&exists)
+	require.NoError(t, err)
+	assert.False(t, exists, "read should be served by the replica")
+
+	err = cluster.QueryRow(ForcePrimary(ctx), "SELECT to_regclass('test_cluster') IS NOT NULL").Scan(&exists)
+	require.NoError(t, err)
+	assert.True(t, exists, "forced read should be served by the primary")
+
+	// A failing replica leaves the rotation and reads fall back to the primary
+	require.NoError(t, replicaContainer.Stop(ctx, nil))
+	cluster.CheckReplicas(ctx)
+	assert.Equal(t, 0, cluster.HealthyReplicas())
+
+	err = cluster.QueryRow(ctx, "SELECT to_regclass('test_cluster') IS NOT NULL").Scan(&exists)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestIntegration_Cluster_ReplicaJoinsAfterStartingDown(t *testing.T) {
+	_, primaryCfg := setupTestContainer(t)
+	_, replicaCfg := setupTestContainer(t)
+
+	// Reserve a port for the replica, with nothing listening on it yet
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	proxyAddr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	target := net.JoinHostPort(replicaCfg.Host, strconv.Itoa(replicaCfg.Port))
+	replicaCfg.Host = "127.0.0.1"
+	replicaCfg.Port = ln.Addr().(*net.TCPAddr).Port
+
+	primary, err := NewConnection(primaryCfg)
+	require.NoError(t, err)
+	replica, err := NewConnection(replicaCfg,
+		WithHealthTimeout(time.Second),
+		WithConnectRetryPolicy(ConnectRetryPolicy{InitialDelay: 50 * time.Millisecond, MaxDelay: 200 * time.Millisecond}),
+	)
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(primary, []*Connection{replica}, WithReplicaHealthInterval(100*time.Millisecond))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	ctx := context.Background()
+	require.NoError(t, cluster.Connect(ctx))
+	assert.Equal(t, 0, cluster.HealthyReplicas())
+
+	// The replica comes up
+	ln, err = net.Listen("tcp", proxyAddr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go forwardConnections(ln, target)
+
+	require.Eventually(t, func() bool {
+		return cluster.HealthyReplicas() == 1
+	}, 15*time.Second, 50*time.Millisecond, "the replica rejoins once it is reachable")
+}
+
+// forwardConnections proxies every connection accepted by ln to target.
+func forwardConnections(ln net.Listener, target string) {
+	for {
+		client, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = client.Close() }()
+
+			server, err := net.Dial("tcp", target)
+			if err != nil {
+				return
+			}
+			defer func() { _ = server.Close() }()
+
+			go func() { _, _ = io.Copy(server, client) }()
+			_, _ = io.Copy(client, server)
+		}()
+	}
+}
+
+func TestIntegration_Cluster_DetailedHealthReportsLag(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+
+	primary, err := NewConnection(cfg)
+	require.NoError(t, err)
+	replica, err := NewConnection(cfg)
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(primary, []*Connection{replica},
+		WithReplicaHealthInterval(0),
+		WithMaxReplicationLag(time.Second),
+	)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	ctx := context.Background()
+	require.NoError(t, cluster.Connect(ctx))
+	select {
+	case <-replica.Ready():
+	case <-time.After(10 * time.Second):
+		t.Fatal("replica did not connect")
+	}
+
+	status := cluster.DetailedHealth(ctx)
+	assert.True(t, status.Healthy)
+	require.Len(t, status.Replicas, 1)
+
+	// A server that is not in recovery reports zero lag
+	assert.True(t, status.Replicas[0].InRotation)
+	assert.True(t, status.Replicas[0].LagKnown)
+	assert.Zero(t, status.Replicas[0].ReplicationLag)
+
+	assert.Same(t, replica, cluster.Reader(MaxStaleness(ctx, time.Millisecond)))
+}
+
+// setReadOnly makes every session on the server behind conn read-only, or
+// writable again, the way a demoted or promoted node would appear.
+func setReadOnly(t *testing.T, conn *Connection, readOnly bool) {
+	t.Helper()
+
+	ctx := context.Background()
+	stmt := "ALTER SYSTEM RESET default_transaction_read_only"
+	if readOnly {
+		stmt = "ALTER SYSTEM SET default_transaction_read_only = on"
+	}
+	_, err := conn.Exec(ctx, stmt)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "SELECT pg_reload_conf()")
+	require.NoError(t, err)
+}
+
+func TestIntegration_Connection_MultiHostFailover(t *testing.T) {
+	_, cfgA := setupTestContainer(t)
+	_, cfgB := setupTestContainer(t)
+	ctx := context.Background()
+
+	adminA, err := NewConnection(cfgA)
+	require.NoError(t, err)
+	require.NoError(t, adminA.Connect(ctx))
+	defer adminA.Close()
+
+	adminB, err := NewConnection(cfgB)
+	require.NoError(t, err)
+	require.NoError(t, adminB.Connect(ctx))
+	defer adminB.Close()
+
+	// A starts as a standby, B as the primary
+	setReadOnly(t, adminA, true)
+
+	hostA := fmt.Sprintf("%s:%d", cfgA.Host, cfgA.Port)
+	hostB := fmt.Sprintf("%s:%d", cfgB.Host, cfgB.Port)
+	conn, err := NewConnection(cfgA,
+		WithHosts(hostA, hostB),
+		WithTargetSessionAttrs(TargetReadWrite),
+	)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(ctx))
+	defer conn.Close()
+
+	_, err = conn.Exec(ctx, "CREATE TABLE before_failover (id INT)")
+	require.NoError(t, err)
+
+	var onB bool
+	err = adminB.QueryRow(ctx, "SELECT to_regclass('before_failover') IS NOT NULL").Scan(&onB)
+	require.NoError(t, err)
+	assert.True(t, onB, "write should land on the read-write host")
+
+	// Fail over: B is demoted and A promoted
+	setReadOnly(t, adminB, true)
+	setReadOnly(t, adminA, false)
+
+	// The first write after the failover may fail on B; the pool is then reset
+	// and later writes land on A
+	require.Eventually(t, func() bool {
+		_, err := conn.Exec(ctx, "CREATE TABLE IF NOT EXISTS after_failover (id INT)")
+		return err == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	var onA bool
+	err = adminA.QueryRow(ctx, "SELECT to_regclass('after_failover') IS NOT NULL").Scan(&onA)
+	require.NoError(t, err)
+	assert.True(t, onA, "write should land on the promoted host")
+}
+
+func TestIntegration_Connection_ResetPoolUnderLoad(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	ctx := context.Background()
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(ctx))
+	defer conn.Close()
+
+	_, err = conn.Exec(ctx, "CREATE TABLE reset_load (id INT)")
+	require.NoError(t, err)
+
+	var (
+		stop   atomic.Bool
+		wg     sync.WaitGroup
+		failed atomic.Int64
+		done   atomic.Int64
+	)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				var err error
+				switch i % 3 {
+				case 0:
+					_, err = conn.Exec(ctx, "INSERT INTO reset_load VALUES ($1)", i)
+				case 1:
+					var n int
+					err = conn.QueryRow(ctx, "SELECT count(*) FROM reset_load").Scan(&n)
+				default:
+					// A transaction spanning a reset keeps its connection
+					err = conn.WithTransaction(ctx, func(tx pgx.Tx) error {
+						if _, err := tx.Exec(ctx, "INSERT INTO reset_load VALUES ($1)", i); err != nil {
+							return err
+						}
+						time.Sleep(5 * time.Millisecond)
+						_, err := tx.Exec(ctx, "INSERT INTO reset_load VALUES ($1)", i)
+						return err
+					})
+				}
+				if err != nil {
+					t.Logf("query failed during reset: %v", err)
+					failed.Add(1)
+				}
+				done.Add(1)
+			}
+		}()
+	}
+
+	for range 20 {
+		require.NoError(t, conn.ResetPool(ctx))
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	assert.Zero(t, failed.Load(), "no query should fail while the pool is replaced")
+	assert.Positive(t, done.Load())
+	assert.NoError(t, conn.Health(ctx))
+}
+
+func TestIntegration_Connection_ShutdownWaitsForTransaction(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	ctx := context.Background()
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(ctx))
+	defer conn.Close()
+
+	_, err = conn.Exec(ctx, "CREATE TABLE shutdown_drain (id INT)")
+	require.NoError(t, err)
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, "INSERT INTO shutdown_drain VALUES (1)")
+	require.NoError(t, err)
+
+	type result struct {
+		interrupted int
+		err         error
+	}
+	shutdown := make(chan result, 1)
+	go func() {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		interrupted, err := conn.Shutdown(shutdownCtx)
+		shutdown <- result{interrupted, err}
+	}()
+
+	// New work is refused while the transaction finishes
+	require.Eventually(t, func() bool {
+		_, err := conn.Exec(ctx, "SELECT 1")
+		return errors.Is(err, ErrShuttingDown)
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = tx.Exec(ctx, "INSERT INTO shutdown_drain VALUES (2)")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	res := <-shutdown
+	require.NoError(t, res.err)
+	assert.Zero(t, res.interrupted)
+
+	// The committed rows are visible to a fresh connection
+	require.NoError(t, conn.Connect(ctx))
+	var n int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT count(*) FROM shutdown_drain").Scan(&n))
+	assert.Equal(t, 2, n)
+}
+
+func TestIntegration_Connection_ShutdownInterruptsAtDeadline(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	ctx := context.Background()
+
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(ctx))
+	defer conn.Close()
+
+	queryErr := make(chan error, 1)
+	go func() {
+		_, err := conn.Exec(ctx, "SELECT pg_sleep(30)")
+		queryErr <- err
+	}()
+	require.Eventually(t, func() bool {
+		return conn.Stats().AcquiredConns() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	interrupted, err := conn.Shutdown(shutdownCtx)
+
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 1, interrupted)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "interrupted 1 connections")
+
+	select {
+	case err := <-queryErr:
+		assert.Error(t, err, "the interrupted query should fail")
+	case <-time.After(5 * time.Second):
+		t.Fatal("interrupted query did not return")
+	}
+}
+
+func TestIntegration_Connection_FileCredentialProviderRotation(t *testing.T) {
+	_, cfg := setupTestContainer(t)
+	ctx := context.Background()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("testpass\n"), 0o600))
+
+	cfg.Password = ""
+	cfg.MinConns = 1
+	conn, err := NewConnection(cfg, WithCredentialProvider(NewFileCredentialProvider(passwordFile)))
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(ctx))
+	defer conn.Close()
+
+	// Rotate the password on the server and in the mounted secret
+	_, err = conn.Exec(ctx, "ALTER USER testuser PASSWORD 'rotated'")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(passwordFile, []byte("rotated\n"), 0o600))
+
+	// Holding every existing connection forces the pool to open new ones
+	held := make([]*pgxpool.Conn, 0, cfg.MaxConns)
+	defer func() {
+		for _, c := range held {
+			c.Release()
+		}
+	}()
+	for range cfg.MaxConns {
+		c, err := conn.Pool().Acquire(ctx)
+		require.NoError(t, err, "new connections should use the rotated password")
+		held = append(held, c)
+	}
+}
+
+// setupTLSContainer starts PostgreSQL with TLS enabled, serving a certificate
+// for localhost signed by ca and requesting client certificates signed by it.
+// Connections need WithServerName("localhost") when the Docker host differs.
+func setupTLSContainer(t *testing.T, ca *testCert) *config.DatabaseConfig {
+	t.Helper()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert, serverKey := ca.issue(t, "postgres", "localhost", "127.0.0.1").write(t, dir, "server")
+
+	const certDir = "/tmp/testcontainers-go/postgres/"
+	postgresContainer, err := postgres.Run(
+		ctx,
+		"postgres:16-alpine",
+		postgres.WithDatabase("testdb"),
+		postgres.WithUsername("testuser"),
+		postgres.WithPassword("testpass"),
+		postgres.WithSSLCert(caFile, serverCert, serverKey),
+		testcontainers.WithCmdArgs(
+			"-c", "ssl=on",
+			"-c", "ssl_cert_file="+certDir+"server.cert",
+			"-c", "ssl_key_file="+certDir+"server.key",
+			"-c", "ssl_ca_file="+certDir+"ca_cert.pem",
+		),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(60*time.Second),
+		),
+	)
+	testcontainers.CleanupContainer(t, postgresContainer)
+	require.NoError(t, err)
+
+	host, err := postgresContainer.Host(ctx)
+	require.NoError(t, err)
+
+	port, err := postgresContainer.MappedPort(ctx, "5432")
+	require.NoError(t, err)
+
+	return &config.DatabaseConfig{
+		Host:     host,
+		Port:     int(port.Num()),
+		Database: "testdb",
+		User:     "testuser",
+		Password: "testpass",
+		SSLMode:  "verify-full",
+		MaxConns: 4,
+	}
+}
+
+func TestIntegration_Connection_TLSVerifyFull(t *testing.T) {
+	ca := newTestCA(t, "test-ca")
+	cfg := setupTLSContainer(t, ca)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := ca.issue(t, "first-client").write(t, dir, "client")
+
+	conn, err := NewConnection(cfg,
+		WithRootCAFile(caFile),
+		WithClientCertificate(certFile, keyFile),
+		WithServerName("localhost"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(ctx))
+	defer conn.Close()
+
+	clientDN := func() string {
+		var ssl bool
+		var dn *string
+		err := conn.QueryRow(ctx,
+			"SELECT ssl, client_dn FROM pg_stat_ssl WHERE pid = pg_backend_pid()",
+		).Scan(&ssl, &dn)
+		require.NoError(t, err)
+		require.True(t, ssl)
+		if dn == nil {
+			return ""
+		}
+		return *dn
+	}
+	assert.Contains(t, clientDN(), "first-client")
+
+	// A renewed client certificate is presented by connections opened after it
+	ca.issue(t, "second-client").write(t, dir, "client")
+	touchLater(t, certFile, keyFile)
+	conn.Pool().Reset()
+	assert.Contains(t, clientDN(), "second-client")
+}
+
+func TestIntegration_Connection_TLSRejectsUntrustedServer(t *testing.T) {
+	cfg := setupTLSContainer(t, newTestCA(t, "server-ca"))
+
+	other := newTestCA(t, "other-ca")
+	caFile, _ := other.write(t, t.TempDir(), "ca")
+
+	conn, err := NewConnection(cfg,
+		WithRootCAFile(caFile),
+		WithServerName("localhost"),
+		WithRetryTimeout(time.Second),
+	)
+	require.NoError(t, err)
+
+	require.Error(t, conn.Connect(context.Background()))
+	assert.Nil(t, conn.Pool())
+}
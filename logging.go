@@ -0,0 +1,94 @@
+package pgxutils
+
+import (
+	"context"
+	"log/slog"
+	"math"
+)
+
+// LogEvent identifies a log line emitted by this package.
+//
+// Events let a LogLevelPolicy raise or lower individual log lines without
+// matching on message text.
+type LogEvent string
+
+const (
+	// LogEventConnected is logged when Connect establishes the pool.
+	LogEventConnected LogEvent = "connected"
+	// LogEventConnectAttemptFailed is logged for each failed Connect attempt.
+	LogEventConnectAttemptFailed LogEvent = "connect_attempt_failed"
+	// LogEventClosed is logged when Close shuts the pool down.
+	LogEventClosed LogEvent = "closed"
+	// LogEventRollbackSkipped is logged when a rollback fails for an expected reason.
+	LogEventRollbackSkipped LogEvent = "rollback_skipped"
+	// LogEventRollbackFailed is logged when a rollback fails unexpectedly.
+	LogEventRollbackFailed LogEvent = "rollback_failed"
+	// LogEventMigrationCleanup is logged when closing a migrate instance fails.
+	LogEventMigrationCleanup LogEvent = "migration_cleanup"
+)
+
+// LevelOff is returned by a LogLevelPolicy to drop a log line entirely.
+const LevelOff = slog.Level(math.MaxInt)
+
+// LogLevelPolicy decides the level a log event is emitted at.
+//
+// It receives the event and the level the package would use by default, and
+// returns the level to log at, or LevelOff to suppress the line.
+type LogLevelPolicy func(event LogEvent, level slog.Level) slog.Level
+
+// LogLevelOverrides returns a LogLevelPolicy that uses the given level for each
+// listed event and leaves every other event at its default level.
+//
+// Example usage:
+//
+//	policy := pgxutils.LogLevelOverrides(map[pgxutils.LogEvent]slog.Level{
+//	    pgxutils.LogEventConnectAttemptFailed: pgxutils.LevelOff,
+//	})
+func LogLevelOverrides(overrides map[LogEvent]slog.Level) LogLevelPolicy {
+	levels := make(map[LogEvent]slog.Level, len(overrides))
+	for event, level := range overrides {
+		levels[event] = level
+	}
+
+	return func(event LogEvent, level slog.Level) slog.Level {
+		if override, ok := levels[event]; ok {
+			return override
+		}
+		return level
+	}
+}
+
+// eventLogger pairs a logger with the level policy applied to its events.
+//
+// String and error arguments are redacted before logging: connection string
+// passwords are always removed, as is every occurrence of secrets.
+type eventLogger struct {
+	logger  *slog.Logger
+	levels  LogLevelPolicy
+	secrets []string
+}
+
+// newEventLogger falls back to slog.Default() when logger is nil.
+func newEventLogger(logger *slog.Logger, levels LogLevelPolicy) eventLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return eventLogger{logger: logger, levels: levels}
+}
+
+// log emits msg at the level chosen by the policy, tagged with the event name.
+func (l eventLogger) log(ctx context.Context, event LogEvent, level slog.Level, msg string, args ...any) {
+	if l.levels != nil {
+		level = l.levels(event, level)
+	}
+	if level == LevelOff {
+		return
+	}
+
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	args = redactArgs(args, l.secrets)
+	l.logger.Log(ctx, level, redact(msg, l.secrets...), append(args, "event", string(event))...)
+}
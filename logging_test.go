@@ -0,0 +1,64 @@
+package pgxutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevelOverrides(t *testing.T) {
+	policy := LogLevelOverrides(map[LogEvent]slog.Level{
+		LogEventConnectAttemptFailed: slog.LevelDebug,
+	})
+
+	assert.Equal(t, slog.LevelDebug, policy(LogEventConnectAttemptFailed, slog.LevelWarn))
+	assert.Equal(t, slog.LevelInfo, policy(LogEventConnected, slog.LevelInfo))
+}
+
+func TestEventLogger_AppliesPolicy(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	events := newEventLogger(logger, func(event LogEvent, level slog.Level) slog.Level {
+		return slog.LevelError
+	})
+	events.log(context.Background(), LogEventConnected, slog.LevelInfo, "database connection established")
+
+	assert.Contains(t, buf.String(), "ERROR")
+	assert.Contains(t, buf.String(), "event=connected")
+}
+
+func TestEventLogger_LevelOffSuppresses(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	events := newEventLogger(logger, LogLevelOverrides(map[LogEvent]slog.Level{
+		LogEventRollbackFailed: LevelOff,
+	}))
+	handleTransactionRollback(context.Background(), &mockTransaction{rollbackErr: errors.New("boom")}, events)
+
+	assert.Empty(t, buf.String())
+}
+
+func TestConnection_ConnectLogsToInjectedLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	cfg := baseConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 1
+
+	conn, err := NewConnection(cfg, WithLogger(logger), WithRetryTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+
+	err = conn.Connect(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, buf.String(), "connection attempt failed")
+	assert.Contains(t, buf.String(), "event=connect_attempt_failed")
+}
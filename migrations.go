@@ -1,8 +1,9 @@
 package pgxutils
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -11,8 +12,12 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
-// RunMigrations runs database migrations using golang-migrate
-func RunMigrations(databaseURL, migrationsPath string) error {
+// RunMigrations runs database migrations using golang-migrate.
+//
+// The password in databaseURL is redacted from returned errors and logs.
+//
+// Only the logging options (WithLogger, WithLogLevelPolicy) apply; others are ignored.
+func RunMigrations(databaseURL, migrationsPath string, opts ...Option) error {
 	absPath, err := filepath.Abs(migrationsPath)
 	if err != nil {
 		return fmt.Errorf("failed to resolve migration path: %w", err)
@@ -30,24 +35,22 @@ func RunMigrations(databaseURL, migrationsPath string) error {
 		databaseURL,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		return fmt.Errorf("failed to create migrate instance: %w", redactError(err, urlSecrets(databaseURL)...))
 	}
 
-	defer func() {
-		if closeErr := closeMigrate(m); closeErr != nil {
-			log.Printf("Warning during migrate cleanup: %v", closeErr)
-		}
-	}()
+	defer closeMigrateLogged(m, databaseURL, opts)
 
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("failed to run migrations: %w", err)
+		return fmt.Errorf("failed to run migrations: %w", redactError(err, urlSecrets(databaseURL)...))
 	}
 
 	return nil
 }
 
-// RollbackMigrations rolls back the last migration
-func RollbackMigrations(databaseURL, migrationsPath string) error {
+// RollbackMigrations rolls back the last migration.
+//
+// Only the logging options (WithLogger, WithLogLevelPolicy) apply; others are ignored.
+func RollbackMigrations(databaseURL, migrationsPath string, opts ...Option) error {
 	absPath, err := filepath.Abs(migrationsPath)
 	if err != nil {
 		return fmt.Errorf("failed to resolve migration path: %w", err)
@@ -58,22 +61,45 @@ func RollbackMigrations(databaseURL, migrationsPath string) error {
 		databaseURL,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		return fmt.Errorf("failed to create migrate instance: %w", redactError(err, urlSecrets(databaseURL)...))
 	}
 
-	defer func() {
-		if closeErr := closeMigrate(m); closeErr != nil {
-			log.Printf("Warning during migrate cleanup: %v", closeErr)
-		}
-	}()
+	defer closeMigrateLogged(m, databaseURL, opts)
 
 	if err := m.Steps(-1); err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("failed to rollback migration: %w", err)
+		return fmt.Errorf("failed to rollback migration: %w", redactError(err, urlSecrets(databaseURL)...))
 	}
 
 	return nil
 }
 
+// closeMigrateLogged closes the migrate instance, logging rather than
+// returning any cleanup error so it cannot mask the migration result.
+func closeMigrateLogged(m *migrate.Migrate, databaseURL string, opts []Option) {
+	if closeErr := closeMigrate(m); closeErr != nil {
+		events := migrationEvents(opts)
+		events.secrets = urlSecrets(databaseURL)
+		events.log(
+			context.Background(),
+			LogEventMigrationCleanup,
+			slog.LevelWarn,
+			"migrate cleanup failed",
+			"error", closeErr,
+		)
+	}
+}
+
+// migrationEvents builds the event logger from the logging options in opts.
+func migrationEvents(opts []Option) eventLogger {
+	var connOpts connectionOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&connOpts)
+		}
+	}
+	return newEventLogger(connOpts.logger, connOpts.logLevels)
+}
+
 // closeMigrate safely closes the migrate instance
 func closeMigrate(m *migrate.Migrate) error {
 	sourceErr, dbErr := m.Close()
@@ -0,0 +1,158 @@
+package pgxotel
+
+import (
+	"context"
+	"errors"
+
+	pgxutils "github.com/JohnPlummer/jp-go-pgx-utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Attribute keys set on pool metrics.
+const (
+	AttrPoolName = attribute.Key("pool.name")
+	AttrState    = attribute.Key("state")
+)
+
+// MetricsOption is a functional option for configuring RegisterMetrics.
+type MetricsOption func(*metricsOptions)
+
+// metricsOptions holds optional configuration for RegisterMetrics.
+type metricsOptions struct {
+	provider metric.MeterProvider
+	poolName string
+	attrs    []attribute.KeyValue
+}
+
+// WithMeterProvider sets the provider instruments are created from.
+// Default is otel.GetMeterProvider().
+func WithMeterProvider(provider metric.MeterProvider) MetricsOption {
+	return func(opts *metricsOptions) {
+		opts.provider = provider
+	}
+}
+
+// WithPoolName sets the pool.name attribute, so services with several
+// Connections can tell them apart. Default is the database name.
+func WithPoolName(name string) MetricsOption {
+	return func(opts *metricsOptions) {
+		opts.poolName = name
+	}
+}
+
+// WithMetricAttributes adds attributes to every observation.
+func WithMetricAttributes(attrs ...attribute.KeyValue) MetricsOption {
+	return func(opts *metricsOptions) {
+		opts.attrs = append(opts.attrs, attrs...)
+	}
+}
+
+// RegisterMetrics registers asynchronous instruments mirroring conn's PoolMetrics,
+// following the db.client.connections.* semantic conventions:
+//
+//   - db.client.connections.usage: acquired (state=used) and idle (state=idle) connections
+//   - db.client.connections.max: maximum pool size
+//   - db.client.connections.total: all open connections, including those being constructed
+//   - db.client.connections.empty_acquires: acquires that waited for a connection
+//   - db.client.connections.canceled_acquires: acquires canceled by their context
+//
+// Every observation carries pool.name and db.name. Nothing is observed until
+// conn has connected. Call Unregister on the returned registration when the
+// Connection is closed.
+//
+// Example usage:
+//
+//	reg, err := pgxotel.RegisterMetrics(conn, pgxotel.WithPoolName("primary"))
+//	if err != nil {
+//	    return err
+//	}
+//	defer reg.Unregister()
+func RegisterMetrics(conn *pgxutils.Connection, opts ...MetricsOption) (metric.Registration, error) {
+	if conn == nil {
+		return nil, errors.New("connection cannot be nil")
+	}
+
+	var o metricsOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	if o.provider == nil {
+		o.provider = otel.GetMeterProvider()
+	}
+
+	meter := o.provider.Meter(instrumentationName)
+
+	usage, err := meter.Int64ObservableUpDownCounter("db.client.connections.usage",
+		metric.WithDescription("The number of connections that are currently in the state described by the state attribute."),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	maxConns, err := meter.Int64ObservableUpDownCounter("db.client.connections.max",
+		metric.WithDescription("The maximum number of open connections allowed."),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	total, err := meter.Int64ObservableUpDownCounter("db.client.connections.total",
+		metric.WithDescription("The number of open connections, including those being constructed."),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	emptyAcquires, err := meter.Int64ObservableCounter("db.client.connections.empty_acquires",
+		metric.WithDescription("The number of acquires that waited for a connection because the pool was empty."),
+		metric.WithUnit("{acquire}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	canceledAcquires, err := meter.Int64ObservableCounter("db.client.connections.canceled_acquires",
+		metric.WithDescription("The number of acquires canceled by their context."),
+		metric.WithUnit("{acquire}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return meter.RegisterCallback(func(_ context.Context, obs metric.Observer) error {
+		// One pool and one snapshot of it, so the observations agree with each
+		// other even if ResetPool swaps the pool meanwhile
+		pool := conn.Pool()
+		if pool == nil {
+			return nil
+		}
+		stats := pool.Stat()
+
+		database := pool.Config().ConnConfig.Database
+		poolName := o.poolName
+		if poolName == "" {
+			poolName = database
+		}
+
+		base := append([]attribute.KeyValue{
+			AttrPoolName.String(poolName),
+			AttrDBName.String(database),
+		}, o.attrs...)
+		attrs := metric.WithAttributeSet(attribute.NewSet(base...))
+
+		obs.ObserveInt64(usage, int64(stats.AcquiredConns()), metric.WithAttributeSet(
+			attribute.NewSet(append(base[:len(base):len(base)], AttrState.String("used"))...),
+		))
+		obs.ObserveInt64(usage, int64(stats.IdleConns()), metric.WithAttributeSet(
+			attribute.NewSet(append(base[:len(base):len(base)], AttrState.String("idle"))...),
+		))
+		obs.ObserveInt64(maxConns, int64(stats.MaxConns()), attrs)
+		obs.ObserveInt64(total, int64(stats.TotalConns()), attrs)
+		obs.ObserveInt64(emptyAcquires, stats.EmptyAcquireCount(), attrs)
+		obs.ObserveInt64(canceledAcquires, stats.CanceledAcquireCount(), attrs)
+		return nil
+	}, usage, maxConns, total, emptyAcquires, canceledAcquires)
+}
@@ -0,0 +1,192 @@
+package pgxotel
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	config "github.com/JohnPlummer/jp-go-config"
+	pgxutils "github.com/JohnPlummer/jp-go-pgx-utils"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRegisterMetrics_NilConnection(t *testing.T) {
+	_, err := RegisterMetrics(nil)
+	require.Error(t, err)
+}
+
+func TestRegisterMetrics_NoObservationsBeforeConnect(t *testing.T) {
+	conn, err := pgxutils.NewConnection(&config.DatabaseConfig{
+		Host:     "localhost",
+		Port:     5432,
+		Database: "testdb",
+		User:     "testuser",
+		Password: "testpass",
+		SSLMode:  "disable",
+	})
+	require.NoError(t, err)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	reg, err := RegisterMetrics(conn, WithMeterProvider(provider), WithPoolName("primary"))
+	require.NoError(t, err)
+	defer func() { _ = reg.Unregister() }()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	points := 0
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				points += len(data.DataPoints)
+			case metricdata.Gauge[int64]:
+				points += len(data.DataPoints)
+			}
+		}
+	}
+	assert.Zero(t, points)
+}
+
+// fakeServer accepts PostgreSQL connections, completes their startup without
+// authentication and answers every simple query with an empty result, which is
+// enough for a pool to connect and ping.
+func fakeServer(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFake(c)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func serveFake(c net.Conn) {
+	defer func() { _ = c.Close() }()
+
+	backend := pgproto3.NewBackend(c, c)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: []byte{0, 0, 0, 1}})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := backend.Flush(); err != nil {
+		return
+	}
+
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch msg.(type) {
+		case *pgproto3.Query:
+			backend.Send(&pgproto3.EmptyQueryResponse{})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if err := backend.Flush(); err != nil {
+				return
+			}
+		case *pgproto3.Terminate:
+			return
+		}
+	}
+}
+
+// dataPoint is an int64 observation and its attributes.
+type dataPoint struct {
+	value int64
+	attrs attribute.Set
+}
+
+// collectPoints reads every int64 data point, by instrument name.
+func collectPoints(t *testing.T, reader *sdkmetric.ManualReader) map[string][]dataPoint {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	points := make(map[string][]dataPoint)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if data, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range data.DataPoints {
+					points[m.Name] = append(points[m.Name], dataPoint{value: dp.Value, attrs: dp.Attributes})
+				}
+			}
+		}
+	}
+	return points
+}
+
+func TestRegisterMetrics_ObservesPool(t *testing.T) {
+	conn, err := pgxutils.NewConnection(&config.DatabaseConfig{
+		Host:     "127.0.0.1",
+		Port:     fakeServer(t),
+		Database: "testdb",
+		User:     "testuser",
+		Password: "testpass",
+		SSLMode:  "disable",
+		MaxConns: 4,
+	})
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(context.Background()))
+	defer conn.Close()
+
+	held, err := conn.Pool().Acquire(context.Background())
+	require.NoError(t, err)
+	defer held.Release()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	reg, err := RegisterMetrics(conn, WithMeterProvider(provider), WithPoolName("primary"))
+	require.NoError(t, err)
+	defer func() { _ = reg.Unregister() }()
+
+	points := collectPoints(t, reader)
+
+	value := func(name string, extra ...attribute.KeyValue) int64 {
+		t.Helper()
+		for _, dp := range points[name] {
+			matches := true
+			for _, kv := range append([]attribute.KeyValue{
+				AttrPoolName.String("primary"),
+				AttrDBName.String("testdb"),
+			}, extra...) {
+				if v, ok := dp.attrs.Value(kv.Key); !ok || v != kv.Value {
+					matches = false
+				}
+			}
+			if matches {
+				return dp.value
+			}
+		}
+		t.Fatalf("no %s data point with pool.name, db.name and %v", name, extra)
+		return 0
+	}
+
+	stats := conn.Pool().Stat()
+	assert.Equal(t, int64(1), value("db.client.connections.usage", AttrState.String("used")))
+	assert.Equal(t, int64(stats.IdleConns()), value("db.client.connections.usage", AttrState.String("idle")))
+	assert.Equal(t, int64(4), value("db.client.connections.max"))
+	assert.Equal(t, int64(stats.TotalConns()), value("db.client.connections.total"))
+	assert.Equal(t, int64(0), value("db.client.connections.canceled_acquires"))
+	assert.Contains(t, points, "db.client.connections.empty_acquires")
+}
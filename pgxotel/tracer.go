@@ -0,0 +1,241 @@
+// Package pgxotel provides OpenTelemetry instrumentation for pgxutils connections.
+//
+// It lives in its own package so that services which do not use OpenTelemetry
+// do not pull it in through the core pgxutils package.
+package pgxotel
+
+import (
+	"context"
+	"fmt"
+
+	pgxutils "github.com/JohnPlummer/jp-go-pgx-utils"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package as the OpenTelemetry instrumentation scope.
+const instrumentationName = "github.com/JohnPlummer/jp-go-pgx-utils/pgxotel"
+
+// Attribute keys set on spans.
+const (
+	AttrDBSystem       = attribute.Key("db.system")
+	AttrDBName         = attribute.Key("db.name")
+	AttrDBStatement    = attribute.Key("db.statement")
+	AttrDBOperation    = attribute.Key("db.operation")
+	AttrDBSQLTable     = attribute.Key("db.sql.table")
+	AttrDBRowsAffected = attribute.Key("db.rows_affected")
+	AttrDBBatchSize    = attribute.Key("db.batch.size")
+	AttrDBSQLState     = attribute.Key("db.postgresql.sqlstate")
+	AttrErrorType      = attribute.Key("error.type")
+)
+
+// Tracer emits an OpenTelemetry client span for every statement.
+//
+// Spans carry db.statement, db.operation and db.name; failed statements record
+// the error, set the span status and add the SQLSTATE code. Covers
+// Exec/Query/QueryRow, SendBatch and CopyFrom.
+type Tracer struct {
+	tracer        trace.Tracer
+	attrs         []attribute.KeyValue
+	omitStatement bool
+	redact        func(string) string
+}
+
+var (
+	_ pgx.QueryTracer          = (*Tracer)(nil)
+	_ pgx.BatchTracer          = (*Tracer)(nil)
+	_ pgx.CopyFromTracer       = (*Tracer)(nil)
+	_ pgxutils.RedactingTracer = (*Tracer)(nil)
+)
+
+// TracerOption is a functional option for configuring Tracer.
+type TracerOption func(*tracerOptions)
+
+// tracerOptions holds optional configuration for Tracer.
+type tracerOptions struct {
+	provider      trace.TracerProvider
+	attrs         []attribute.KeyValue
+	omitStatement bool
+}
+
+// WithTracerProvider sets the provider spans are created from.
+// Default is otel.GetTracerProvider().
+func WithTracerProvider(provider trace.TracerProvider) TracerOption {
+	return func(opts *tracerOptions) {
+		opts.provider = provider
+	}
+}
+
+// WithSpanAttributes adds attributes to every span, such as a pool name.
+func WithSpanAttributes(attrs ...attribute.KeyValue) TracerOption {
+	return func(opts *tracerOptions) {
+		opts.attrs = append(opts.attrs, attrs...)
+	}
+}
+
+// WithoutStatement leaves db.statement off spans, for statements that may
+// embed sensitive literals.
+func WithoutStatement() TracerOption {
+	return func(opts *tracerOptions) {
+		opts.omitStatement = true
+	}
+}
+
+// NewTracer creates a Tracer.
+//
+// Example usage:
+//
+//	conn, err := pgxutils.NewConnection(cfg,
+//	    pgxutils.WithTracer(pgxotel.NewTracer()),
+//	)
+func NewTracer(opts ...TracerOption) *Tracer {
+	var o tracerOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+
+	if o.provider == nil {
+		o.provider = otel.GetTracerProvider()
+	}
+
+	return &Tracer{
+		tracer:        o.provider.Tracer(instrumentationName),
+		attrs:         append([]attribute.KeyValue{AttrDBSystem.String("postgresql")}, o.attrs...),
+		omitStatement: o.omitStatement,
+	}
+}
+
+// WithRedaction implements pgxutils.RedactingTracer. pgxutils.WithTracer calls
+// it, so spans of a Connection's statements never carry its passwords.
+func (t *Tracer) WithRedaction(redact func(string) string) pgx.QueryTracer {
+	redacting := *t
+	redacting.redact = redact
+	return &redacting
+}
+
+// redacted passes s through the redaction, if any.
+func (t *Tracer) redacted(s string) string {
+	if t.redact == nil {
+		return s
+	}
+	return t.redact(s)
+}
+
+// start opens a client span named after the operation.
+func (t *Tracer) start(ctx context.Context, conn *pgx.Conn, name string, attrs ...attribute.KeyValue) context.Context {
+	if name == "" {
+		name = "postgresql"
+	}
+
+	spanAttrs := append(append([]attribute.KeyValue(nil), t.attrs...), attrs...)
+	if conn != nil {
+		spanAttrs = append(spanAttrs, AttrDBName.String(conn.Config().Database))
+	}
+
+	ctx, _ = t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(spanAttrs...),
+	)
+	return ctx
+}
+
+// finish records the outcome on the span from ctx and ends it.
+func (t *Tracer) finish(ctx context.Context, err error, attrs ...attribute.KeyValue) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attrs...)
+	t.recordError(span, err)
+	span.End()
+}
+
+// recordError marks the span as failed and adds the SQLSTATE when err is a PostgreSQL error.
+func (t *Tracer) recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	msg := t.redacted(err.Error())
+	if msg == err.Error() {
+		span.RecordError(err)
+	} else {
+		// The exception event RecordError would add, with the redacted message
+		span.AddEvent("exception", trace.WithAttributes(
+			attribute.String("exception.type", fmt.Sprintf("%T", err)),
+			attribute.String("exception.message", msg),
+		))
+	}
+	span.SetStatus(codes.Error, msg)
+
+	span.SetAttributes(AttrErrorType.String(errorType(err)))
+	if code := pgxutils.SQLState(err); code != "" {
+		span.SetAttributes(AttrDBSQLState.String(code))
+	}
+}
+
+// statementAttrs describes a single SQL statement.
+func (t *Tracer) statementAttrs(sql string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{AttrDBOperation.String(pgxutils.QueryOperation(sql))}
+	if !t.omitStatement {
+		attrs = append(attrs, AttrDBStatement.String(t.redacted(sql)))
+	}
+	return attrs
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *Tracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return t.start(ctx, conn, pgxutils.QueryOperation(data.SQL), t.statementAttrs(data.SQL)...)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *Tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.finish(ctx, data.Err, AttrDBRowsAffected.Int64(data.CommandTag.RowsAffected()))
+}
+
+// TraceBatchStart implements pgx.BatchTracer.
+func (t *Tracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	size := 0
+	if data.Batch != nil {
+		size = data.Batch.Len()
+	}
+	return t.start(ctx, conn, "BATCH", AttrDBOperation.String("BATCH"), AttrDBBatchSize.Int(size))
+}
+
+// TraceBatchQuery implements pgx.BatchTracer. Each statement is recorded as a
+// span event on the batch span.
+func (t *Tracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	attrs := append(t.statementAttrs(data.SQL), AttrDBRowsAffected.Int64(data.CommandTag.RowsAffected()))
+	if data.Err != nil {
+		attrs = append(attrs, AttrErrorType.String(errorType(data.Err)))
+	}
+	trace.SpanFromContext(ctx).AddEvent("batch query", trace.WithAttributes(attrs...))
+}
+
+// TraceBatchEnd implements pgx.BatchTracer.
+func (t *Tracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	t.finish(ctx, data.Err)
+}
+
+// TraceCopyFromStart implements pgx.CopyFromTracer.
+func (t *Tracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return t.start(ctx, conn, "COPY",
+		AttrDBOperation.String("COPY"),
+		AttrDBSQLTable.String(data.TableName.Sanitize()),
+	)
+}
+
+// TraceCopyFromEnd implements pgx.CopyFromTracer.
+func (t *Tracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.finish(ctx, data.Err, AttrDBRowsAffected.Int64(data.CommandTag.RowsAffected()))
+}
+
+// errorType is the SQLSTATE of err, or "error" for non-PostgreSQL errors.
+func errorType(err error) string {
+	if code := pgxutils.SQLState(err); code != "" {
+		return code
+	}
+	return "error"
+}
@@ -0,0 +1,123 @@
+package pgxotel
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracer(opts ...TracerOption) (*Tracer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return NewTracer(append([]TracerOption{WithTracerProvider(provider)}, opts...)...), recorder
+}
+
+func attrMap(attrs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(attrs))
+	for _, kv := range attrs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestTracer_QuerySpan(t *testing.T) {
+	tracer, recorder := newTestTracer(WithSpanAttributes(attribute.String("pool", "primary")))
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT id FROM users"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 2")})
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "SELECT", spans[0].Name())
+
+	attrs := attrMap(spans[0].Attributes())
+	assert.Equal(t, "postgresql", attrs[AttrDBSystem].AsString())
+	assert.Equal(t, "SELECT id FROM users", attrs[AttrDBStatement].AsString())
+	assert.Equal(t, "SELECT", attrs[AttrDBOperation].AsString())
+	assert.Equal(t, int64(2), attrs[AttrDBRowsAffected].AsInt64())
+	assert.Equal(t, "primary", attrs["pool"].AsString())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
+
+func TestTracer_QueryError(t *testing.T) {
+	tracer, recorder := newTestTracer()
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "INSERT INTO users (id) VALUES (1)"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: &pgconn.PgError{Code: "23505", Message: "duplicate key"}})
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+
+	attrs := attrMap(spans[0].Attributes())
+	assert.Equal(t, "23505", attrs[AttrDBSQLState].AsString())
+	assert.Equal(t, "23505", attrs[AttrErrorType].AsString())
+	assert.Len(t, spans[0].Events(), 1) // recorded exception
+}
+
+func TestTracer_WithRedaction(t *testing.T) {
+	base, recorder := newTestTracer()
+	redact := func(s string) string { return strings.ReplaceAll(s, "correct-horse", "xxxxx") }
+	tracer := base.WithRedaction(redact)
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL: "ALTER ROLE app PASSWORD 'correct-horse'",
+	})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{
+		Err: &pgconn.PgError{Code: "42501", Message: "cannot set password correct-horse"},
+	})
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "ALTER ROLE app PASSWORD 'xxxxx'", attrMap(spans[0].Attributes())[AttrDBStatement].AsString())
+	assert.NotContains(t, spans[0].Status().Description, "correct-horse")
+
+	require.Len(t, spans[0].Events(), 1)
+	event := attrMap(spans[0].Events()[0].Attributes)
+	assert.Equal(t, "*pgconn.PgError", event["exception.type"].AsString())
+	assert.NotContains(t, event["exception.message"].AsString(), "correct-horse")
+	assert.Contains(t, event["exception.message"].AsString(), "xxxxx")
+
+	// The original is left unredacted
+	assert.Nil(t, base.redact)
+}
+
+func TestTracer_WithoutStatement(t *testing.T) {
+	tracer, recorder := newTestTracer(WithoutStatement())
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	_, ok := attrMap(spans[0].Attributes())[AttrDBStatement]
+	assert.False(t, ok)
+}
+
+func TestTracer_BatchSpan(t *testing.T) {
+	tracer, recorder := newTestTracer()
+
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT 1")
+	batch.Queue("SELECT 2")
+
+	ctx := tracer.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{Batch: batch})
+	tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 1"})
+	tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 2"})
+	tracer.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{})
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "BATCH", spans[0].Name())
+	assert.Equal(t, int64(2), attrMap(spans[0].Attributes())[AttrDBBatchSize].AsInt64())
+	assert.Len(t, spans[0].Events(), 2)
+}
@@ -0,0 +1,304 @@
+// Package pgxprom exports pgxutils connection pool metrics to Prometheus.
+//
+// It lives in its own package so that services which do not use Prometheus do
+// not pull in client_golang through the core pgxutils package.
+package pgxprom
+
+import (
+	"context"
+	"time"
+
+	pgxutils "github.com/JohnPlummer/jp-go-pgx-utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultNamespace prefixes every metric name unless WithNamespace overrides it.
+const defaultNamespace = "pgxpool"
+
+// Option is a functional option for configuring Collector and QueryTracer.
+type Option func(*options)
+
+// options holds optional configuration shared by Collector and QueryTracer.
+type options struct {
+	namespace   string
+	constLabels prometheus.Labels
+	buckets     []float64
+	durations   *QueryTracer
+}
+
+// WithNamespace sets the metric name prefix.
+// Default is "pgxpool".
+func WithNamespace(namespace string) Option {
+	return func(opts *options) {
+		opts.namespace = namespace
+	}
+}
+
+// WithPoolName adds a "pool" label so services with several Connections can
+// tell their metrics apart.
+func WithPoolName(name string) Option {
+	return WithConstLabels(prometheus.Labels{"pool": name})
+}
+
+// WithConstLabels adds constant labels to every metric.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(opts *options) {
+		if opts.constLabels == nil {
+			opts.constLabels = prometheus.Labels{}
+		}
+		for k, v := range labels {
+			opts.constLabels[k] = v
+		}
+	}
+}
+
+// WithBuckets sets the query duration histogram buckets in seconds.
+// Default is prometheus.DefBuckets.
+func WithBuckets(buckets []float64) Option {
+	return func(opts *options) {
+		opts.buckets = buckets
+	}
+}
+
+// WithQueryDurations includes a QueryTracer's histogram in the Collector, so a
+// single registration exports both pool and query metrics.
+func WithQueryDurations(tracer *QueryTracer) Option {
+	return func(opts *options) {
+		opts.durations = tracer
+	}
+}
+
+func buildOptions(opts []Option) options {
+	o := options{
+		namespace: defaultNamespace,
+		buckets:   prometheus.DefBuckets,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// Collector is a prometheus.Collector exposing a Connection's pool metrics.
+//
+// Every PoolMetrics field is exported, together with AverageAcquireTime and
+// the constructing, new, max-lifetime-destroy and max-idle-destroy counts from
+// pgxpool.Stat. Nothing is exported until the Connection has connected.
+type Collector struct {
+	conn      *pgxutils.Connection
+	durations *QueryTracer
+
+	totalConns           *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	maxConns             *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	averageAcquireTime   *prometheus.Desc
+	newConnsCount        *prometheus.Desc
+	lifetimeDestroyCount *prometheus.Desc
+	idleDestroyCount     *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector creates a Collector for conn.
+//
+// Example usage:
+//
+//	durations := pgxprom.NewQueryTracer(pgxprom.WithPoolName("primary"))
+//	conn, err := pgxutils.NewConnection(cfg, pgxutils.WithTracer(durations))
+//	// ...
+//	prometheus.MustRegister(pgxprom.NewCollector(conn,
+//	    pgxprom.WithPoolName("primary"),
+//	    pgxprom.WithQueryDurations(durations),
+//	))
+func NewCollector(conn *pgxutils.Connection, opts ...Option) *Collector {
+	o := buildOptions(opts)
+
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(o.namespace, "", name), help, nil, o.constLabels)
+	}
+
+	return &Collector{
+		conn:      conn,
+		durations: o.durations,
+
+		totalConns:           desc("total_connections", "Total number of connections in the pool."),
+		acquiredConns:        desc("acquired_connections", "Number of currently acquired connections."),
+		idleConns:            desc("idle_connections", "Number of currently idle connections."),
+		maxConns:             desc("max_connections", "Maximum size of the pool."),
+		constructingConns:    desc("constructing_connections", "Number of connections being constructed."),
+		acquireCount:         desc("acquire_count_total", "Cumulative count of successful acquires."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Total time spent on successful acquires."),
+		emptyAcquireCount:    desc("empty_acquire_count_total", "Cumulative count of acquires that waited for a connection."),
+		canceledAcquireCount: desc("canceled_acquire_count_total", "Cumulative count of acquires canceled by context."),
+		averageAcquireTime:   desc("average_acquire_seconds", "Average time to acquire a connection."),
+		newConnsCount:        desc("new_connections_total", "Cumulative count of new connections opened."),
+		lifetimeDestroyCount: desc("max_lifetime_destroy_count_total", "Cumulative count of connections destroyed for exceeding MaxConnLifetime."),
+		idleDestroyCount:     desc("max_idle_destroy_count_total", "Cumulative count of connections destroyed for exceeding MaxConnIdleTime."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.totalConns
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.maxConns
+	ch <- c.constructingConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquireCount
+	ch <- c.canceledAcquireCount
+	ch <- c.averageAcquireTime
+	ch <- c.newConnsCount
+	ch <- c.lifetimeDestroyCount
+	ch <- c.idleDestroyCount
+
+	if c.durations != nil {
+		c.durations.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	if c.durations != nil {
+		c.durations.Collect(ch)
+	}
+
+	// One snapshot, so the metrics of a scrape agree with each other
+	stats := c.conn.Stats()
+	if stats == nil {
+		return
+	}
+
+	gauge := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v)
+	}
+	counter := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v)
+	}
+
+	var average time.Duration
+	if stats.AcquireCount() > 0 {
+		average = stats.AcquireDuration() / time.Duration(stats.AcquireCount())
+	}
+
+	gauge(c.totalConns, float64(stats.TotalConns()))
+	gauge(c.acquiredConns, float64(stats.AcquiredConns()))
+	gauge(c.idleConns, float64(stats.IdleConns()))
+	gauge(c.maxConns, float64(stats.MaxConns()))
+	gauge(c.constructingConns, float64(stats.ConstructingConns()))
+	counter(c.acquireCount, float64(stats.AcquireCount()))
+	counter(c.acquireDuration, stats.AcquireDuration().Seconds())
+	counter(c.emptyAcquireCount, float64(stats.EmptyAcquireCount()))
+	counter(c.canceledAcquireCount, float64(stats.CanceledAcquireCount()))
+	gauge(c.averageAcquireTime, average.Seconds())
+	counter(c.newConnsCount, float64(stats.NewConnsCount()))
+	counter(c.lifetimeDestroyCount, float64(stats.MaxLifetimeDestroyCount()))
+	counter(c.idleDestroyCount, float64(stats.MaxIdleDestroyCount()))
+}
+
+// QueryTracer is a pgx tracer recording statement durations in a histogram
+// labeled by operation (SELECT, INSERT, BATCH, COPY, ...).
+//
+// It is itself a prometheus.Collector; register it directly or through
+// WithQueryDurations on a Collector.
+type QueryTracer struct {
+	histogram *prometheus.HistogramVec
+}
+
+var (
+	_ pgx.QueryTracer      = (*QueryTracer)(nil)
+	_ pgx.BatchTracer      = (*QueryTracer)(nil)
+	_ pgx.CopyFromTracer   = (*QueryTracer)(nil)
+	_ prometheus.Collector = (*QueryTracer)(nil)
+)
+
+// NewQueryTracer creates a QueryTracer. Attach it with pgxutils.WithTracer.
+func NewQueryTracer(opts ...Option) *QueryTracer {
+	o := buildOptions(opts)
+
+	return &QueryTracer{
+		histogram: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   o.namespace,
+			Name:        "query_duration_seconds",
+			Help:        "Duration of statements executed through the pool.",
+			ConstLabels: o.constLabels,
+			Buckets:     o.buckets,
+		}, []string{"operation"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (t *QueryTracer) Describe(ch chan<- *prometheus.Desc) {
+	t.histogram.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (t *QueryTracer) Collect(ch chan<- prometheus.Metric) {
+	t.histogram.Collect(ch)
+}
+
+// queryStartKey stores the operation and start time of a statement in the context.
+type queryStartKey struct{}
+
+type queryStart struct {
+	operation string
+	start     time.Time
+}
+
+func (t *QueryTracer) begin(ctx context.Context, operation string) context.Context {
+	if operation == "" {
+		operation = "UNKNOWN"
+	}
+	return context.WithValue(ctx, queryStartKey{}, queryStart{operation: operation, start: time.Now()})
+}
+
+func (t *QueryTracer) end(ctx context.Context) {
+	started, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	t.histogram.WithLabelValues(started.operation).Observe(time.Since(started.start).Seconds())
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return t.begin(ctx, pgxutils.QueryOperation(data.SQL))
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	t.end(ctx)
+}
+
+// TraceBatchStart implements pgx.BatchTracer.
+func (t *QueryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return t.begin(ctx, "BATCH")
+}
+
+// TraceBatchQuery implements pgx.BatchTracer. The batch is observed as a whole.
+func (t *QueryTracer) TraceBatchQuery(context.Context, *pgx.Conn, pgx.TraceBatchQueryData) {}
+
+// TraceBatchEnd implements pgx.BatchTracer.
+func (t *QueryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchEndData) {
+	t.end(ctx)
+}
+
+// TraceCopyFromStart implements pgx.CopyFromTracer.
+func (t *QueryTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceCopyFromStartData) context.Context {
+	return t.begin(ctx, "COPY")
+}
+
+// TraceCopyFromEnd implements pgx.CopyFromTracer.
+func (t *QueryTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceCopyFromEndData) {
+	t.end(ctx)
+}
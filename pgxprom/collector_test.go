@@ -0,0 +1,183 @@
+package pgxprom
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	config "github.com/JohnPlummer/jp-go-config"
+	pgxutils "github.com/JohnPlummer/jp-go-pgx-utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConnection(t *testing.T) *pgxutils.Connection {
+	t.Helper()
+
+	conn, err := pgxutils.NewConnection(&config.DatabaseConfig{
+		Host:     "localhost",
+		Port:     5432,
+		Database: "testdb",
+		User:     "testuser",
+		Password: "testpass",
+		SSLMode:  "disable",
+	})
+	require.NoError(t, err)
+	return conn
+}
+
+func TestCollector_DescribesAllMetrics(t *testing.T) {
+	collector := NewCollector(newTestConnection(t))
+
+	ch := make(chan *prometheus.Desc, 32)
+	collector.Describe(ch)
+	close(ch)
+
+	assert.Len(t, ch, 13)
+}
+
+func TestCollector_NoMetricsBeforeConnect(t *testing.T) {
+	collector := NewCollector(newTestConnection(t))
+
+	assert.Equal(t, 0, testutil.CollectAndCount(collector))
+}
+
+// fakeServer accepts PostgreSQL connections, completes their startup without
+// authentication and answers every simple query with an empty result, which is
+// enough for a pool to connect and ping.
+func fakeServer(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFake(c)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func serveFake(c net.Conn) {
+	defer func() { _ = c.Close() }()
+
+	backend := pgproto3.NewBackend(c, c)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: []byte{0, 0, 0, 1}})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := backend.Flush(); err != nil {
+		return
+	}
+
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch msg.(type) {
+		case *pgproto3.Query:
+			backend.Send(&pgproto3.EmptyQueryResponse{})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if err := backend.Flush(); err != nil {
+				return
+			}
+		case *pgproto3.Terminate:
+			return
+		}
+	}
+}
+
+func TestCollector_ReportsPoolStats(t *testing.T) {
+	conn, err := pgxutils.NewConnection(&config.DatabaseConfig{
+		Host:     "127.0.0.1",
+		Port:     fakeServer(t),
+		Database: "testdb",
+		User:     "testuser",
+		Password: "testpass",
+		SSLMode:  "disable",
+		MaxConns: 4,
+	})
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(context.Background()))
+	defer conn.Close()
+
+	held, err := conn.Pool().Acquire(context.Background())
+	require.NoError(t, err)
+	defer held.Release()
+
+	collector := NewCollector(conn, WithPoolName("primary"))
+	stats := conn.Stats()
+	require.EqualValues(t, 1, stats.AcquiredConns())
+
+	expected := fmt.Sprintf(`
+# HELP pgxpool_acquired_connections Number of currently acquired connections.
+# TYPE pgxpool_acquired_connections gauge
+pgxpool_acquired_connections{pool="primary"} 1
+# HELP pgxpool_idle_connections Number of currently idle connections.
+# TYPE pgxpool_idle_connections gauge
+pgxpool_idle_connections{pool="primary"} %d
+# HELP pgxpool_max_connections Maximum size of the pool.
+# TYPE pgxpool_max_connections gauge
+pgxpool_max_connections{pool="primary"} 4
+# HELP pgxpool_total_connections Total number of connections in the pool.
+# TYPE pgxpool_total_connections gauge
+pgxpool_total_connections{pool="primary"} %d
+# HELP pgxpool_acquire_count_total Cumulative count of successful acquires.
+# TYPE pgxpool_acquire_count_total counter
+pgxpool_acquire_count_total{pool="primary"} %d
+# HELP pgxpool_canceled_acquire_count_total Cumulative count of acquires canceled by context.
+# TYPE pgxpool_canceled_acquire_count_total counter
+pgxpool_canceled_acquire_count_total{pool="primary"} 0
+# HELP pgxpool_new_connections_total Cumulative count of new connections opened.
+# TYPE pgxpool_new_connections_total counter
+pgxpool_new_connections_total{pool="primary"} %d
+`, stats.IdleConns(), stats.TotalConns(), stats.AcquireCount(), stats.NewConnsCount())
+
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"pgxpool_acquired_connections",
+		"pgxpool_idle_connections",
+		"pgxpool_max_connections",
+		"pgxpool_total_connections",
+		"pgxpool_acquire_count_total",
+		"pgxpool_canceled_acquire_count_total",
+		"pgxpool_new_connections_total",
+	))
+}
+
+func TestCollector_IncludesQueryDurations(t *testing.T) {
+	durations := NewQueryTracer(WithPoolName("primary"))
+	collector := NewCollector(newTestConnection(t), WithPoolName("primary"), WithQueryDurations(durations))
+
+	ctx := durations.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	durations.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	assert.Equal(t, 1, testutil.CollectAndCount(collector, "pgxpool_query_duration_seconds"))
+}
+
+func TestQueryTracer_LabelsByOperation(t *testing.T) {
+	tracer := NewQueryTracer(WithNamespace("app"))
+
+	for _, sql := range []string{"SELECT 1", "select 2", "INSERT INTO t VALUES (1)"} {
+		ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	}
+	ctx := tracer.TraceCopyFromStart(context.Background(), nil, pgx.TraceCopyFromStartData{})
+	tracer.TraceCopyFromEnd(ctx, nil, pgx.TraceCopyFromEndData{})
+
+	assert.Equal(t, 3, testutil.CollectAndCount(tracer, "app_query_duration_seconds"))
+}
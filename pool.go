@@ -2,16 +2,24 @@ package pgxutils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
+	errors "github.com/JohnPlummer/jp-go-errors"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// PoolMetrics provides detailed metrics about the connection pool
+// PoolMetrics provides detailed metrics about the connection pool.
+//
+// TotalAcquireTime is serialized twice: in milliseconds as
+// total_acquire_time_ms, and as integer nanoseconds under the original
+// total_acquire_time key. The nanosecond key is deprecated and will be removed
+// in a future major version.
 type PoolMetrics struct {
 	TotalConns           int32         `json:"total_connections"`
 	AcquiredConns        int32         `json:"acquired_connections"`
@@ -23,13 +31,45 @@ type PoolMetrics struct {
 	CanceledAcquireCount int64         `json:"canceled_acquire_count"`
 }
 
+// MarshalJSON adds TotalAcquireTime in fractional milliseconds to the default
+// encoding.
+func (m PoolMetrics) MarshalJSON() ([]byte, error) {
+	type plain PoolMetrics
+	return json.Marshal(struct {
+		plain
+		TotalAcquireTimeMs float64 `json:"total_acquire_time_ms"`
+	}{
+		plain:              plain(m),
+		TotalAcquireTimeMs: float64(m.TotalAcquireTime) / float64(time.Millisecond),
+	})
+}
+
+// UnmarshalJSON decodes the form written by MarshalJSON, taking
+// TotalAcquireTime from total_acquire_time_ms when present and from the
+// nanosecond key otherwise.
+func (m *PoolMetrics) UnmarshalJSON(data []byte) error {
+	type plain PoolMetrics
+	aux := struct {
+		*plain
+		TotalAcquireTimeMs *float64 `json:"total_acquire_time_ms"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.TotalAcquireTimeMs != nil {
+		m.TotalAcquireTime = time.Duration(*aux.TotalAcquireTimeMs * float64(time.Millisecond))
+	}
+	return nil
+}
+
 // GetMetrics returns current pool metrics
 func (db *Connection) GetMetrics() *PoolMetrics {
-	if db.pool == nil {
+	pool := db.currentPool()
+	if pool == nil {
 		return &PoolMetrics{}
 	}
 
-	stats := db.pool.Stat()
+	stats := pool.Stat()
 	return &PoolMetrics{
 		TotalConns:           stats.TotalConns(),
 		AcquiredConns:        stats.AcquiredConns(),
@@ -52,11 +92,13 @@ type ConnectionWrapper struct {
 
 // Acquire gets a connection from the pool with context
 func (db *Connection) Acquire(ctx context.Context) (*ConnectionWrapper, error) {
-	if db.pool == nil {
-		return nil, fmt.Errorf("database pool not initialized")
+	h, err := db.usePool(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer h.release()
 
-	conn, err := db.pool.Acquire(ctx)
+	conn, err := h.pool.Acquire(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
@@ -83,6 +125,62 @@ func (cw *ConnectionWrapper) Conn() *pgxpool.Conn {
 	return cw.conn
 }
 
+// active returns the underlying connection, or an error once it is released
+func (cw *ConnectionWrapper) active() (*pgxpool.Conn, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if cw.closed || cw.conn == nil {
+		return nil, fmt.Errorf("connection already released")
+	}
+	return cw.conn, nil
+}
+
+// Exec executes queries without result rows on the acquired connection
+func (cw *ConnectionWrapper) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	conn, err := cw.active()
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return conn.Exec(ctx, sql, args...)
+}
+
+// Query executes queries returning multiple rows on the acquired connection
+func (cw *ConnectionWrapper) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	conn, err := cw.active()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Query(ctx, sql, args...)
+}
+
+// QueryRow executes queries expecting a single row on the acquired connection
+func (cw *ConnectionWrapper) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	conn, err := cw.active()
+	if err != nil {
+		return &emptyRow{err: err}
+	}
+	return conn.QueryRow(ctx, sql, args...)
+}
+
+// SendBatch sends a batch of queries on the acquired connection
+func (cw *ConnectionWrapper) SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults {
+	conn, err := cw.active()
+	if err != nil {
+		return &errorBatchResults{err: err}
+	}
+	return conn.SendBatch(ctx, batch)
+}
+
+// CopyFrom performs a bulk insert on the acquired connection
+func (cw *ConnectionWrapper) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	conn, err := cw.active()
+	if err != nil {
+		return 0, err
+	}
+	return conn.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
 // WithConnection executes a function with a database connection
 func (db *Connection) WithConnection(ctx context.Context, fn func(*pgxpool.Conn) error) error {
 	conn, err := db.Acquire(ctx)
@@ -96,11 +194,14 @@ func (db *Connection) WithConnection(ctx context.Context, fn func(*pgxpool.Conn)
 
 // WithTransaction executes a function within a database transaction
 func (db *Connection) WithTransaction(ctx context.Context, fn func(pgx.Tx) error) error {
-	if db.pool == nil {
-		return fmt.Errorf("database pool not initialized")
-	}
+	return db.WithTransactionOptions(ctx, pgx.TxOptions{}, fn)
+}
 
-	tx, err := db.pool.Begin(ctx)
+// WithTransactionOptions executes a function within a database transaction
+// started with the given isolation level, access mode and deferrable mode.
+// If ctx carries a transaction (see ContextWithTx), a savepoint is used instead
+func (db *Connection) WithTransactionOptions(ctx context.Context, txOptions pgx.TxOptions, fn func(pgx.Tx) error) error {
+	tx, err := db.beginContextTx(ctx, txOptions)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -121,7 +222,7 @@ func (db *Connection) WithTransaction(ctx context.Context, fn func(pgx.Tx) error
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return fmt.Errorf("failed to commit transaction: %w", db.classify(err))
 	}
 
 	return nil
@@ -129,20 +230,29 @@ func (db *Connection) WithTransaction(ctx context.Context, fn func(pgx.Tx) error
 
 // CopyFrom performs a bulk insert using PostgreSQL COPY protocol
 func (db *Connection) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
-	if db.pool == nil {
-		return 0, fmt.Errorf("database pool not initialized")
+	h, err := db.usePool(ctx)
+	if err != nil {
+		return 0, err
 	}
+	defer h.release()
 
-	return db.pool.CopyFrom(ctx, tableName, columnNames, rowSrc)
+	n, err := h.pool.CopyFrom(ctx, tableName, columnNames, rowSrc)
+	return n, db.classify(err)
 }
 
 // SendBatch sends a batch of queries to be executed
 func (db *Connection) SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults {
-	if db.pool == nil {
-		return &errorBatchResults{err: fmt.Errorf("database pool not initialized")}
+	h, err := db.usePool(ctx)
+	if err != nil {
+		return &errorBatchResults{err: err}
 	}
+	defer h.release()
 
-	return db.pool.SendBatch(ctx, batch)
+	results := h.pool.SendBatch(ctx, batch)
+	if db.opts.classifyErrors {
+		return classifyingBatchResults{results: results}
+	}
+	return results
 }
 
 // errorBatchResults implements pgx.BatchResults for error cases
@@ -166,23 +276,76 @@ func (e *errorBatchResults) Close() error {
 	return e.err
 }
 
-// ResetPool closes and recreates the connection pool
+// ResetPool replaces the connection pool without interrupting callers.
 // This can be useful for handling certain types of connection errors
+//
+// A new pool is built and pinged first; if that fails the current pool stays
+// in service and the error is returned. Otherwise the new pool takes over
+// atomically, and the old one is closed once the connections acquired from it,
+// including those of running queries and open transactions, are released.
+// Without a current pool, ResetPool connects as Connect does, unless Shutdown
+// has been called.
 func (db *Connection) ResetPool(ctx context.Context) error {
-	db.Close()
-	return db.Connect(ctx)
+	if db.shuttingDown.Load() {
+		return ErrShuttingDown
+	}
+
+	old := db.pool.Load()
+	if old == nil {
+		return db.Connect(ctx)
+	}
+
+	poolConfig, err := db.buildPoolConfig()
+	if err != nil {
+		return err
+	}
+
+	h, err := openPool(ctx, poolConfig)
+	if err != nil {
+		return errors.NewProcessingError(
+			"failed to open replacement pool",
+			"database_reset_pool",
+			errors.WithCause(redactError(err, db.secrets()...)),
+		)
+	}
+
+	if !db.pool.CompareAndSwap(old, h) {
+		// Closed, or replaced by a concurrent reset, while the pool was opening
+		h.pool.Close()
+		if db.pool.Load() == nil {
+			if db.shuttingDown.Load() {
+				return ErrShuttingDown
+			}
+			return errors.New("connection closed during pool reset")
+		}
+		return nil
+	}
+	db.drain(old)
+
+	db.events().log(
+		ctx,
+		LogEventPoolReplaced,
+		slog.LevelInfo,
+		"database connection pool replaced",
+		"host", landedHost(ctx, h.pool),
+	)
+	return nil
 }
 
 // AverageAcquireTime returns the average time to acquire a connection
 func (db *Connection) AverageAcquireTime() time.Duration {
-	if db.pool == nil {
+	pool := db.currentPool()
+	if pool == nil {
 		return 0
 	}
 
-	stats := db.pool.Stat()
+	return averageAcquireTime(pool.Stat())
+}
+
+// averageAcquireTime returns the average acquire time recorded in stats.
+func averageAcquireTime(stats *pgxpool.Stat) time.Duration {
 	if stats.AcquireCount() == 0 {
 		return 0
 	}
-
 	return time.Duration(int64(stats.AcquireDuration()) / stats.AcquireCount())
 }
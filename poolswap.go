@@ -0,0 +1,107 @@
+package pgxutils
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Log events emitted when the pool is replaced.
+const (
+	// LogEventPoolReplaced is logged when ResetPool swaps in a new pool.
+	LogEventPoolReplaced LogEvent = "pool_replaced"
+	// LogEventPoolDrained is logged when a replaced pool has been closed.
+	LogEventPoolDrained LogEvent = "pool_drained"
+)
+
+// poolHandle is a pool together with a count of its users, so that a replaced
+// pool is only closed once nobody can still start using it.
+//
+// The Connection owns one reference while the handle is current, so the count
+// can only reach zero once the handle has been retired and every caller that
+// took a reference has released it.
+type poolHandle struct {
+	pool  *pgxpool.Pool
+	conns *connRegistry // the pool's connections, for Shutdown
+
+	refs     atomic.Int64
+	idle     chan struct{} // closed once retired with no references
+	idleOnce sync.Once
+}
+
+func newPoolHandle(pool *pgxpool.Pool, conns *connRegistry) *poolHandle {
+	h := &poolHandle{pool: pool, conns: conns, idle: make(chan struct{})}
+	h.refs.Store(1)
+	return h
+}
+
+// release drops a reference.
+func (h *poolHandle) release() {
+	if h.refs.Add(-1) == 0 {
+		h.idleOnce.Do(func() { close(h.idle) })
+	}
+}
+
+// retire drops the Connection's reference once the handle has been replaced.
+func (h *poolHandle) retire() {
+	h.release()
+}
+
+// usePool returns the current pool handle with a reference held. The caller
+// must call release once it has acquired its connection, or finished with the
+// pool.
+//
+// Before the pool is established it returns the error from notConnectedError,
+// or, while ConnectAsync is still connecting, waits as awaitConnect decides.
+//
+// A replaced pool is not closed while a reference is held, so a caller never
+// acquires from a pool that is closing. Connections it acquired keep the old
+// pool open until they are released.
+func (c *Connection) usePool(ctx context.Context) (*poolHandle, error) {
+	waited := false
+	for {
+		h := c.pool.Load()
+		if h == nil {
+			if waited {
+				return nil, c.notConnectedError()
+			}
+			if err := c.awaitConnect(ctx); err != nil {
+				return nil, err
+			}
+			waited = true
+			continue
+		}
+
+		h.refs.Add(1)
+		// Only a handle still current after taking the reference is safe:
+		// one replaced in between may already be draining
+		if c.pool.Load() == h {
+			return h, nil
+		}
+		h.release()
+	}
+}
+
+// currentPool returns the current pool without holding it, for reading stats.
+func (c *Connection) currentPool() *pgxpool.Pool {
+	if h := c.pool.Load(); h != nil {
+		return h.pool
+	}
+	return nil
+}
+
+// drain closes a replaced pool once no caller can start using it and every
+// connection acquired from it has been released.
+func (c *Connection) drain(old *poolHandle) {
+	old.retire()
+
+	go func() {
+		<-old.idle
+		// Close blocks until acquired connections are released
+		old.pool.Close()
+		c.events().log(context.Background(), LogEventPoolDrained, slog.LevelDebug, "replaced connection pool closed")
+	}()
+}
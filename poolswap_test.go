@@ -0,0 +1,168 @@
+package pgxutils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableConnection returns a Connection to a port nothing listens on.
+func unreachableConnection(t *testing.T, opts ...Option) *Connection {
+	t.Helper()
+
+	cfg := baseConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 1
+	conn, err := NewConnection(cfg, opts...)
+	require.NoError(t, err)
+	return conn
+}
+
+// lazyPool creates a pool for conn without connecting; with no minimum
+// connections it never dials unless a connection is acquired.
+func lazyPool(t *testing.T, conn *Connection) *pgxpool.Pool {
+	t.Helper()
+
+	poolConfig, err := conn.buildPoolConfig()
+	require.NoError(t, err)
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	require.NoError(t, err)
+	return pool
+}
+
+// poolClosed reports whether pool rejects acquires because it is closed.
+func poolClosed(pool *pgxpool.Pool) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	conn, err := pool.Acquire(ctx)
+	if err == nil {
+		conn.Release()
+		return false
+	}
+	return err.Error() == "closed pool"
+}
+
+func TestUsePool_NotConnected(t *testing.T) {
+	conn := unreachableConnection(t)
+	h, err := conn.usePool(context.Background())
+	assert.Nil(t, h)
+	assert.ErrorIs(t, err, errPoolNotInitialized)
+	assert.Nil(t, conn.Pool())
+}
+
+func TestPoolSwap_DrainWaitsForReferences(t *testing.T) {
+	conn := unreachableConnection(t)
+	oldPool := lazyPool(t, conn)
+	conn.pool.Store(newPoolHandle(oldPool, &connRegistry{}))
+	defer conn.Close()
+
+	h, err := conn.usePool(context.Background())
+	require.NoError(t, err)
+	assert.Same(t, oldPool, h.pool)
+
+	newPool := lazyPool(t, conn)
+	old := conn.pool.Swap(newPoolHandle(newPool, &connRegistry{}))
+	conn.drain(old)
+	assert.Same(t, newPool, conn.Pool())
+
+	// The old pool stays open while a caller may still acquire from it
+	select {
+	case <-old.idle:
+		t.Fatal("replaced pool drained while still referenced")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.False(t, poolClosed(oldPool))
+
+	h.release()
+	assert.Eventually(t, func() bool { return poolClosed(oldPool) }, time.Second, 10*time.Millisecond)
+	assert.False(t, poolClosed(newPool))
+}
+
+func TestPoolSwap_ConcurrentUse(t *testing.T) {
+	conn := unreachableConnection(t)
+	conn.pool.Store(newPoolHandle(lazyPool(t, conn), &connRegistry{}))
+	defer conn.Close()
+
+	var (
+		stop      atomic.Bool
+		wg        sync.WaitGroup
+		uses      atomic.Int64
+		violation atomic.Bool
+	)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				h, err := conn.usePool(context.Background())
+				if err != nil {
+					violation.Store(true)
+					return
+				}
+				select {
+				case <-h.idle:
+					violation.Store(true)
+				default:
+				}
+				uses.Add(1)
+				h.release()
+			}
+		}()
+	}
+
+	retired := make([]*poolHandle, 0, 50)
+	for range 50 {
+		old := conn.pool.Swap(newPoolHandle(lazyPool(t, conn), &connRegistry{}))
+		conn.drain(old)
+		retired = append(retired, old)
+		time.Sleep(time.Millisecond)
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	assert.False(t, violation.Load(), "a caller used a pool that was draining")
+	assert.Positive(t, uses.Load())
+	for _, old := range retired {
+		select {
+		case <-old.idle:
+		case <-time.After(time.Second):
+			t.Fatal("replaced pool never drained")
+		}
+	}
+}
+
+func TestResetPool_FailureKeepsCurrentPool(t *testing.T) {
+	conn := unreachableConnection(t)
+	current := lazyPool(t, conn)
+	conn.pool.Store(newPoolHandle(current, &connRegistry{}))
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := conn.ResetPool(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open replacement pool")
+	assert.Same(t, current, conn.Pool())
+	assert.False(t, poolClosed(current))
+}
+
+func TestClose_RetiresPool(t *testing.T) {
+	conn := unreachableConnection(t)
+	pool := lazyPool(t, conn)
+	conn.pool.Store(newPoolHandle(pool, &connRegistry{}))
+
+	conn.Close()
+	assert.Nil(t, conn.Pool())
+	assert.True(t, poolClosed(pool))
+
+	// Closing twice is harmless
+	conn.Close()
+}
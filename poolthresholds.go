@@ -0,0 +1,274 @@
+package pgxutils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Severity grades a PoolViolation.
+type Severity string
+
+// Severities of pool threshold violations.
+const (
+	// SeverityWarning marks a pool under strain that still serves requests.
+	SeverityWarning Severity = "warning"
+	// SeverityCritical marks a pool that cannot serve more requests.
+	// CheckConnections, and so health checks, fail on critical violations only.
+	SeverityCritical Severity = "critical"
+)
+
+// PoolRule names a rule checked by CheckPool.
+type PoolRule string
+
+// Rules checked by CheckPool.
+const (
+	// PoolRuleUtilization compares acquired connections with MaxConns.
+	PoolRuleUtilization PoolRule = "utilization"
+	// PoolRuleMinIdle compares idle connections with PoolThresholds.MinIdle.
+	PoolRuleMinIdle PoolRule = "min_idle"
+	// PoolRuleEmptyAcquireRate checks the share of recent acquires that had
+	// to wait for a connection.
+	PoolRuleEmptyAcquireRate PoolRule = "empty_acquire_rate"
+	// PoolRuleAverageAcquireTime compares the average time recent acquires
+	// took with PoolThresholds.MaxAverageAcquireTime.
+	PoolRuleAverageAcquireTime PoolRule = "average_acquire_time"
+)
+
+// PoolThresholds sets the limits CheckPool enforces. Zero fields disable their
+// rule, except MaxUtilization and EmptyAcquireWindow, which take defaults.
+type PoolThresholds struct {
+	// MaxUtilization is the share of MaxConns in use that raises a warning.
+	// An exhausted pool is always critical. Default is 1, exhaustion only.
+	MaxUtilization float64
+	// MinIdle is the number of idle connections below which a warning is raised.
+	MinIdle int32
+	// MaxEmptyAcquireRate is the share of acquires within EmptyAcquireWindow
+	// that found no idle connection, above which a warning is raised.
+	MaxEmptyAcquireRate float64
+	// EmptyAcquireWindow is the period MaxEmptyAcquireRate and
+	// MaxAverageAcquireTime are measured over, between calls to CheckPool.
+	// When calls are further apart, they cover the time since the previous
+	// call. Default is one minute.
+	EmptyAcquireWindow time.Duration
+	// MaxAverageAcquireTime is the average time to acquire a connection
+	// within EmptyAcquireWindow above which a warning is raised.
+	MaxAverageAcquireTime time.Duration
+}
+
+// WithPoolThresholds sets the limits checked by CheckPool and CheckConnections.
+// Default flags only an exhausted pool.
+func WithPoolThresholds(thresholds PoolThresholds) Option {
+	return func(opts *connectionOptions) {
+		opts.poolThresholds = thresholds
+	}
+}
+
+// withDefaults fills the fields that have defaults.
+func (t PoolThresholds) withDefaults() PoolThresholds {
+	if t.MaxUtilization <= 0 || t.MaxUtilization > 1 {
+		t.MaxUtilization = 1
+	}
+	if t.EmptyAcquireWindow <= 0 {
+		t.EmptyAcquireWindow = time.Minute
+	}
+	return t
+}
+
+// PoolViolation is a pool rule that CheckPool found broken.
+type PoolViolation struct {
+	Rule     PoolRule `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Value is the measured value and Limit the threshold it broke, in the
+	// rule's unit: a share from 0 to 1, a count, or milliseconds.
+	Value float64 `json:"value"`
+	Limit float64 `json:"limit"`
+}
+
+// PoolCheck is the outcome of CheckPool.
+type PoolCheck struct {
+	Violations []PoolViolation `json:"violations"`
+}
+
+// Healthy reports whether no violation is critical.
+func (c PoolCheck) Healthy() bool {
+	return c.Err() == nil
+}
+
+// Err returns an error describing the critical violations, or nil if there are none.
+func (c PoolCheck) Err() error {
+	var messages []string
+	for _, v := range c.Violations {
+		if v.Severity == SeverityCritical {
+			messages = append(messages, v.Message)
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// CheckPool checks the pool against the thresholds set by WithPoolThresholds
+// and lists every rule it breaks. It returns an error only without a pool.
+//
+// Example usage:
+//
+//	check, err := conn.CheckPool()
+//	if err != nil {
+//	    return err
+//	}
+//	for _, v := range check.Violations {
+//	    log.Printf("%s %s: %s", v.Severity, v.Rule, v.Message)
+//	}
+func (db *Connection) CheckPool() (PoolCheck, error) {
+	pool := db.currentPool()
+	if pool == nil {
+		return PoolCheck{}, db.notConnectedError()
+	}
+
+	thresholds := db.opts.poolThresholds.withDefaults()
+	stats := pool.Stat()
+	var check PoolCheck
+
+	acquired, maxConns := stats.AcquiredConns(), stats.MaxConns()
+	utilization := float64(acquired) / float64(maxConns)
+	switch {
+	case acquired >= maxConns:
+		check.Violations = append(check.Violations, PoolViolation{
+			Rule:     PoolRuleUtilization,
+			Severity: SeverityCritical,
+			Message:  fmt.Sprintf("connection pool exhausted: %d/%d connections in use", acquired, maxConns),
+			Value:    utilization,
+			Limit:    1,
+		})
+	case utilization >= thresholds.MaxUtilization:
+		check.Violations = append(check.Violations, PoolViolation{
+			Rule:     PoolRuleUtilization,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("connection pool %.0f%% utilized: %d/%d connections in use", utilization*100, acquired, maxConns),
+			Value:    utilization,
+			Limit:    thresholds.MaxUtilization,
+		})
+	}
+
+	if idle := stats.IdleConns(); thresholds.MinIdle > 0 && idle < thresholds.MinIdle {
+		check.Violations = append(check.Violations, PoolViolation{
+			Rule:     PoolRuleMinIdle,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("only %d idle connections, want at least %d", idle, thresholds.MinIdle),
+			Value:    float64(idle),
+			Limit:    float64(thresholds.MinIdle),
+		})
+	}
+
+	recent, known := db.poolSamples.window(pool, poolSample{
+		at:       time.Now(),
+		acquires: stats.AcquireCount(),
+		empty:    stats.EmptyAcquireCount(),
+		duration: stats.AcquireDuration(),
+	}, thresholds.EmptyAcquireWindow)
+	if !known {
+		return check, nil
+	}
+
+	if rate := recent.emptyRate(); thresholds.MaxEmptyAcquireRate > 0 && rate > thresholds.MaxEmptyAcquireRate {
+		check.Violations = append(check.Violations, PoolViolation{
+			Rule:     PoolRuleEmptyAcquireRate,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%.0f%% of acquires waited for a connection in the last %s", rate*100, thresholds.EmptyAcquireWindow),
+			Value:    rate,
+			Limit:    thresholds.MaxEmptyAcquireRate,
+		})
+	}
+
+	if thresholds.MaxAverageAcquireTime > 0 {
+		if average := recent.averageAcquireTime(); average > thresholds.MaxAverageAcquireTime {
+			check.Violations = append(check.Violations, PoolViolation{
+				Rule:     PoolRuleAverageAcquireTime,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("average acquire time %s in the last %s exceeds %s", average, thresholds.EmptyAcquireWindow, thresholds.MaxAverageAcquireTime),
+				Value:    float64(average) / float64(time.Millisecond),
+				Limit:    float64(thresholds.MaxAverageAcquireTime) / float64(time.Millisecond),
+			})
+		}
+	}
+
+	return check, nil
+}
+
+// poolSample is a pool's acquire counters at one point in time.
+type poolSample struct {
+	at       time.Time
+	acquires int64
+	empty    int64
+	duration time.Duration // total time spent acquiring
+}
+
+// poolWindow is the change in a pool's acquire counters between two samples.
+type poolWindow struct {
+	acquires int64
+	empty    int64
+	duration time.Duration
+}
+
+// emptyRate returns the share of acquires that found the pool empty.
+func (w poolWindow) emptyRate() float64 {
+	return float64(w.empty) / float64(w.acquires)
+}
+
+// averageAcquireTime returns the average time an acquire took.
+func (w poolWindow) averageAcquireTime() time.Duration {
+	return w.duration / time.Duration(w.acquires)
+}
+
+// poolSampler keeps the acquire counters seen by recent CheckPool calls, to
+// measure rates over a window.
+type poolSampler struct {
+	mu      sync.Mutex
+	pool    *pgxpool.Pool // the pool the samples came from
+	samples []poolSample  // oldest first
+}
+
+// window records now and returns the change in the acquire counters since a
+// baseline sample. The baseline is the newest sample at least window old, or
+// the oldest sample while none is, so checks at intervals of window or more
+// still measure a change. It reports false until there is an earlier sample
+// with acquires since.
+func (s *poolSampler) window(pool *pgxpool.Pool, now poolSample, window time.Duration) (poolWindow, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Counters start again with a new pool
+	if pool != s.pool {
+		s.pool = pool
+		s.samples = s.samples[:0]
+	}
+
+	// Samples older than the baseline are dropped
+	cutoff := now.at.Add(-window)
+	old := 0
+	for old < len(s.samples) && !s.samples[old].at.After(cutoff) {
+		old++
+	}
+	if old > 0 {
+		s.samples = s.samples[old-1:]
+	}
+	s.samples = append(s.samples, now)
+
+	base := s.samples[0]
+	w := poolWindow{
+		acquires: now.acquires - base.acquires,
+		empty:    now.empty - base.empty,
+		duration: now.duration - base.duration,
+	}
+	if w.acquires <= 0 {
+		return poolWindow{}, false
+	}
+	return w, true
+}
@@ -0,0 +1,197 @@
+package pgxutils
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolThresholds_Defaults(t *testing.T) {
+	got := PoolThresholds{MinIdle: 2}.withDefaults()
+	assert.Equal(t, 1.0, got.MaxUtilization)
+	assert.Equal(t, time.Minute, got.EmptyAcquireWindow)
+	assert.Equal(t, int32(2), got.MinIdle)
+
+	got = PoolThresholds{MaxUtilization: 0.8, EmptyAcquireWindow: time.Second}.withDefaults()
+	assert.Equal(t, 0.8, got.MaxUtilization)
+	assert.Equal(t, time.Second, got.EmptyAcquireWindow)
+}
+
+func TestPoolCheck_OnlyCriticalViolationsFail(t *testing.T) {
+	check := PoolCheck{Violations: []PoolViolation{
+		{Rule: PoolRuleMinIdle, Severity: SeverityWarning, Message: "only 0 idle connections, want at least 2"},
+	}}
+	assert.True(t, check.Healthy())
+	assert.NoError(t, check.Err())
+
+	check.Violations = append(check.Violations, PoolViolation{
+		Rule:     PoolRuleUtilization,
+		Severity: SeverityCritical,
+		Message:  "connection pool exhausted: 10/10 connections in use",
+	})
+	assert.False(t, check.Healthy())
+	require.Error(t, check.Err())
+	assert.Equal(t, "connection pool exhausted: 10/10 connections in use", check.Err().Error())
+}
+
+func TestPoolViolation_JSON(t *testing.T) {
+	data, err := json.Marshal(PoolViolation{
+		Rule:     PoolRuleAverageAcquireTime,
+		Severity: SeverityWarning,
+		Message:  "average acquire time 80ms exceeds 50ms",
+		Value:    80,
+		Limit:    50,
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"rule": "average_acquire_time",
+		"severity": "warning",
+		"message": "average acquire time 80ms exceeds 50ms",
+		"value": 80,
+		"limit": 50
+	}`, string(data))
+}
+
+func TestCheckPool_NotConnected(t *testing.T) {
+	conn := unreachableConnection(t)
+	_, err := conn.CheckPool()
+	assert.ErrorIs(t, err, errPoolNotInitialized)
+	assert.ErrorIs(t, conn.CheckConnections(), errPoolNotInitialized)
+}
+
+func TestCheckPool_QuietPoolIsHealthy(t *testing.T) {
+	conn := unreachableConnection(t)
+	pool := lazyPool(t, conn)
+	t.Cleanup(pool.Close)
+	conn.pool.Store(newPoolHandle(pool, &connRegistry{}))
+
+	check, err := conn.CheckPool()
+	require.NoError(t, err)
+	assert.Empty(t, check.Violations)
+	assert.NoError(t, conn.CheckConnections())
+}
+
+func TestCheckPool_MinIdleIsAWarning(t *testing.T) {
+	conn := unreachableConnection(t, WithPoolThresholds(PoolThresholds{MinIdle: 2}))
+	pool := lazyPool(t, conn)
+	t.Cleanup(pool.Close)
+	conn.pool.Store(newPoolHandle(pool, &connRegistry{}))
+
+	check, err := conn.CheckPool()
+	require.NoError(t, err)
+	require.Len(t, check.Violations, 1)
+	assert.Equal(t, PoolRuleMinIdle, check.Violations[0].Rule)
+	assert.Equal(t, SeverityWarning, check.Violations[0].Severity)
+	assert.Equal(t, 0.0, check.Violations[0].Value)
+	assert.Equal(t, 2.0, check.Violations[0].Limit)
+	assert.NoError(t, conn.CheckConnections())
+}
+
+func TestCheckHealth_SkipsPoolWhenDatabaseFails(t *testing.T) {
+	conn := unreachableConnection(t, WithPoolThresholds(PoolThresholds{MinIdle: 2}))
+	pool := lazyPool(t, conn)
+	t.Cleanup(pool.Close)
+	conn.pool.Store(newPoolHandle(pool, &connRegistry{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// The database is unreachable, so DetailedHealth fails first
+	status := conn.checkHealth(ctx)
+	assert.False(t, status.Healthy)
+	assert.Empty(t, status.PoolViolations)
+}
+
+func TestPoolSampler_EmptyAcquireRate(t *testing.T) {
+	conn := unreachableConnection(t)
+	pool := lazyPool(t, conn)
+	t.Cleanup(pool.Close)
+
+	var s poolSampler
+	start := time.Now()
+	sample := func(offset time.Duration, acquires, empty int64) poolSample {
+		return poolSample{at: start.Add(offset), acquires: acquires, empty: empty}
+	}
+
+	_, known := s.window(pool, sample(0, 100, 10), time.Minute)
+	assert.False(t, known, "a single sample has no baseline")
+
+	w, known := s.window(pool, sample(30*time.Second, 200, 60), time.Minute)
+	require.True(t, known)
+	assert.InDelta(t, 0.5, w.emptyRate(), 1e-9)
+
+	// The second sample is the newest a window old, so it is the baseline
+	w, known = s.window(pool, sample(90*time.Second, 300, 70), time.Minute)
+	require.True(t, known)
+	assert.InDelta(t, 0.1, w.emptyRate(), 1e-9)
+
+	_, known = s.window(pool, sample(200*time.Second, 300, 70), time.Minute)
+	assert.False(t, known, "no acquires within the window")
+
+	// A new pool restarts the counters
+	other := lazyPool(t, conn)
+	t.Cleanup(other.Close)
+	_, known = s.window(other, sample(210*time.Second, 5, 0), time.Minute)
+	assert.False(t, known)
+}
+
+func TestPoolSampler_AverageAcquireTimeOverWindow(t *testing.T) {
+	conn := unreachableConnection(t)
+	pool := lazyPool(t, conn)
+	t.Cleanup(pool.Close)
+
+	var s poolSampler
+	start := time.Now()
+	sample := func(offset time.Duration, acquires int64, duration time.Duration) poolSample {
+		return poolSample{at: start.Add(offset), acquires: acquires, duration: duration}
+	}
+
+	// A slow start leaves a high lifetime average
+	_, known := s.window(pool, sample(0, 100, 10*time.Second), time.Minute)
+	assert.False(t, known)
+
+	w, known := s.window(pool, sample(time.Minute, 200, 10*time.Second+100*time.Millisecond), time.Minute)
+	require.True(t, known)
+	assert.Equal(t, time.Millisecond, w.averageAcquireTime(), "only acquires within the window count")
+
+	w, known = s.window(pool, sample(2*time.Minute, 300, 15*time.Second+100*time.Millisecond), time.Minute)
+	require.True(t, known)
+	assert.Equal(t, 50*time.Millisecond, w.averageAcquireTime())
+}
+
+func TestPoolSampler_IntervalNotShorterThanWindow(t *testing.T) {
+	conn := unreachableConnection(t)
+	pool := lazyPool(t, conn)
+	t.Cleanup(pool.Close)
+
+	start := time.Now()
+	for _, interval := range []time.Duration{
+		time.Minute,
+		// A ticker runs a little late, so samples are never exactly a window apart
+		time.Minute + time.Millisecond,
+		5 * time.Minute,
+	} {
+		t.Run(interval.String(), func(t *testing.T) {
+			var s poolSampler
+			_, known := s.window(pool, poolSample{at: start, acquires: 100, empty: 10, duration: time.Second}, time.Minute)
+			assert.False(t, known)
+
+			for i := int64(1); i <= 3; i++ {
+				w, known := s.window(pool, poolSample{
+					at:       start.Add(time.Duration(i) * interval),
+					acquires: 100 + 100*i,
+					empty:    10 + 25*i,
+					duration: time.Second + time.Duration(i)*200*time.Millisecond,
+				}, time.Minute)
+				require.True(t, known, "check %d", i)
+				assert.InDelta(t, 0.25, w.emptyRate(), 1e-9, "check %d", i)
+				assert.Equal(t, 2*time.Millisecond, w.averageAcquireTime(), "check %d", i)
+			}
+			assert.Len(t, s.samples, 2, "only the baseline and the newest sample are kept")
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package pgxutils
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Querier is the query surface shared by Connection, ConnectionWrapper and
+// pgx.Tx, as well as pgx's own *pgxpool.Pool, *pgxpool.Conn and *pgx.Conn.
+//
+// Repositories that accept a Querier work both inside and outside a
+// transaction, and can be unit tested against a mock implementation. Use
+// Connection.FromContext to get the transaction carried by a context, or the
+// Connection itself when there is none.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+var (
+	_ Querier = (*Connection)(nil)
+	_ Querier = (*ConnectionWrapper)(nil)
+	_ Querier = (pgx.Tx)(nil)
+	_ Querier = (*pgxpool.Pool)(nil)
+	_ Querier = (*pgxpool.Conn)(nil)
+	_ Querier = (*pgx.Conn)(nil)
+)
@@ -0,0 +1,47 @@
+package pgxutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countUsers stands in for a repository method written against Querier.
+func countUsers(ctx context.Context, q Querier) (int, error) {
+	var n int
+	err := q.QueryRow(ctx, "SELECT COUNT(*) FROM users").Scan(&n)
+	return n, err
+}
+
+func TestQuerier_ConnectionBeforeConnect(t *testing.T) {
+	conn, err := NewConnection(baseConfig())
+	require.NoError(t, err)
+
+	_, err = countUsers(context.Background(), conn)
+	require.Error(t, err)
+}
+
+func TestConnectionWrapper_ReleasedReturnsErrors(t *testing.T) {
+	cw := &ConnectionWrapper{closed: true}
+	ctx := context.Background()
+
+	var q Querier = cw
+
+	_, err := q.Exec(ctx, "SELECT 1")
+	assert.Error(t, err)
+
+	_, err = q.Query(ctx, "SELECT 1")
+	assert.Error(t, err)
+
+	var n int
+	assert.Error(t, q.QueryRow(ctx, "SELECT 1").Scan(&n))
+
+	_, err = q.SendBatch(ctx, &pgx.Batch{}).Exec()
+	assert.Error(t, err)
+
+	_, err = q.CopyFrom(ctx, pgx.Identifier{"users"}, []string{"name"}, pgx.CopyFromRows(nil))
+	assert.Error(t, err)
+}
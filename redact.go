@@ -0,0 +1,216 @@
+package pgxutils
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// redactedSecret replaces passwords in errors and log attributes.
+const redactedSecret = "xxxxx"
+
+var (
+	// urlPassword matches the password in the userinfo of a connection URL.
+	urlPassword = regexp.MustCompile(`((?:postgres|postgresql|pgx\d*)://[^:/@\s]*:)[^@\s]*@`)
+
+	// keywordPassword matches a password in a keyword/value connection string.
+	keywordPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|[^\s]+)`)
+)
+
+// WithMinSecretLength limits redaction of the Connection's passwords outside
+// connection strings to those of at least n bytes. Shorter ones, such as
+// "postgres", can match unrelated text like a database or user name; they are
+// then redacted only inside connection URLs and password= settings.
+// Default is 0, redacting every password wherever it appears.
+func WithMinSecretLength(n int) Option {
+	return func(opts *connectionOptions) {
+		opts.minSecretLength = n
+	}
+}
+
+// redact removes passwords from s: the password of any connection URL or
+// keyword/value string it contains, and every occurrence of the given
+// secrets, raw or URL-escaped.
+func redact(s string, secrets ...string) string {
+	s = urlPassword.ReplaceAllString(s, "${1}"+redactedSecret+"@")
+	s = keywordPassword.ReplaceAllString(s, "${1}"+redactedSecret)
+
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, redactedSecret)
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			s = strings.ReplaceAll(s, escaped, redactedSecret)
+		}
+		if escaped := url.PathEscape(secret); escaped != secret {
+			s = strings.ReplaceAll(s, escaped, redactedSecret)
+		}
+	}
+
+	return s
+}
+
+// redactedError reports a redacted message while keeping errors.Is and
+// errors.As working against the original error. It deliberately has no Unwrap,
+// which would let callers walking the chain print the unredacted message.
+type redactedError struct {
+	err    error
+	msg    string
+	redact func(string) string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Is implements errors.Is.
+func (e *redactedError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+// As implements errors.As. A *pgconn.PgError or *pgconn.ConnectError found
+// in the original error is returned as a redacted copy.
+func (e *redactedError) As(target any) bool {
+	if !errors.As(e.err, target) {
+		return false
+	}
+
+	switch t := target.(type) {
+	case **pgconn.PgError:
+		pgErr := **t
+		pgErr.Message = e.redact(pgErr.Message)
+		pgErr.Detail = e.redact(pgErr.Detail)
+		pgErr.Hint = e.redact(pgErr.Hint)
+		pgErr.InternalQuery = e.redact(pgErr.InternalQuery)
+		pgErr.Where = e.redact(pgErr.Where)
+		*t = &pgErr
+	case **pgconn.ConnectError:
+		connectErr := **t
+		if connectErr.Config != nil {
+			connectErr.Config = connectErr.Config.Copy()
+			connectErr.Config.Password = redactedSecret
+		}
+		*t = &connectErr
+	}
+	return true
+}
+
+// redactError returns err with passwords removed from its message, or err
+// itself when its message contains none.
+func redactError(err error, secrets ...string) error {
+	return redactErrorWith(err, func(s string) string {
+		return redact(s, secrets...)
+	})
+}
+
+// redactErrorWith is redactError with the redaction given by a RedactingTracer.
+func redactErrorWith(err error, redact func(string) string) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	if clean := redact(msg); clean != msg {
+		return &redactedError{err: err, msg: clean, redact: redact}
+	}
+	return err
+}
+
+// redactArgs redacts string and error values in slog key/value arguments.
+func redactArgs(args []any, secrets []string) []any {
+	out := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case error:
+			out[i] = redactError(v, secrets...)
+		case string:
+			out[i] = redact(v, secrets...)
+		case slog.Attr:
+			out[i] = redactAttr(v, secrets)
+		default:
+			out[i] = arg
+		}
+	}
+	return out
+}
+
+// redactAttr redacts a string or error slog attribute.
+func redactAttr(attr slog.Attr, secrets []string) slog.Attr {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, redact(attr.Value.String(), secrets...))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.Any(attr.Key, redactError(err, secrets...))
+		}
+	}
+	return attr
+}
+
+// urlSecrets returns the password of a connection URL, if any.
+func urlSecrets(databaseURL string) []string {
+	u, err := url.Parse(databaseURL)
+	if err != nil || u.User == nil {
+		return nil
+	}
+	if password, ok := u.User.Password(); ok {
+		return []string{password}
+	}
+	return nil
+}
+
+// secrets returns the values that must never appear in the Connection's
+// errors and logs, leaving out those shorter than WithMinSecretLength.
+func (c *Connection) secrets() []string {
+	candidates := []string{c.cfg.Password, c.dsnPassword}
+	if c.credentials != nil {
+		candidates = append(candidates, c.credentials.password())
+	}
+
+	secrets := candidates[:0]
+	for _, secret := range candidates {
+		if secret != "" && len(secret) >= c.opts.minSecretLength {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// redactSecrets removes the Connection's passwords from s. It is the
+// redaction given to RedactingTracers.
+func (c *Connection) redactSecrets(s string) string {
+	return redact(s, c.secrets()...)
+}
+
+// String describes the Connection by host, database and user, never the password.
+func (c *Connection) String() string {
+	return "postgres://" + c.describeUser() + "@" + c.describeHost() + "/" + c.cfg.Database
+}
+
+// LogValue implements slog.LogValuer, logging host, database and user only.
+func (c *Connection) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("host", c.describeHost()),
+		slog.String("database", c.cfg.Database),
+		slog.String("user", c.cfg.User),
+	)
+}
+
+func (c *Connection) describeUser() string {
+	return url.User(c.cfg.User).String()
+}
+
+// describeHost returns the configured hosts, as given to WithHosts or from the
+// DatabaseConfig.
+func (c *Connection) describeHost() string {
+	if len(c.opts.hosts) > 0 {
+		return strings.Join(c.opts.hosts, ",")
+	}
+	return c.cfg.Host + ":" + strconv.Itoa(c.cfg.Port)
+}
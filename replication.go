@@ -0,0 +1,173 @@
+package pgxutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+)
+
+// WithMaxReplicationLag takes replicas out of the rotation while their
+// replication lag exceeds maxLag, or cannot be measured.
+// Default is zero, which routes to replicas regardless of lag.
+func WithMaxReplicationLag(maxLag time.Duration) ClusterOption {
+	return func(opts *clusterOptions) {
+		opts.maxLag = maxLag
+	}
+}
+
+// stalenessKey stores the maximum acceptable replica lag for reads with a context.
+type stalenessKey struct{}
+
+// MaxStaleness returns a context whose reads through a Cluster only go to
+// replicas lagging the primary by at most maxLag, as of their last check.
+// Reads fall back to the primary when no replica qualifies.
+//
+// Example usage:
+//
+//	err := cluster.QueryRow(pgxutils.MaxStaleness(ctx, time.Second),
+//	    "SELECT balance FROM accounts WHERE id = $1", id).Scan(&balance)
+func MaxStaleness(ctx context.Context, maxLag time.Duration) context.Context {
+	return context.WithValue(ctx, stalenessKey{}, maxLag)
+}
+
+// maxStaleness returns the MaxStaleness set on ctx, or zero.
+func maxStaleness(ctx context.Context) time.Duration {
+	staleness, _ := ctx.Value(stalenessKey{}).(time.Duration)
+	return staleness
+}
+
+// eligible reports whether the replica is in the rotation and, when staleness
+// is positive, its last measured lag is within it.
+func (r *clusterReplica) eligible(staleness time.Duration) bool {
+	if !r.healthy.Load() {
+		return false
+	}
+	if staleness <= 0 {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lagKnown && r.lag <= staleness
+}
+
+// replicationLag measures how far replica trails the primary.
+//
+// A replica that has replayed all WAL the primary has written is not lagging,
+// even if the primary has been idle since. Otherwise the lag is the age of the
+// last replayed transaction. A server that is not in recovery is not a
+// streaming replica and reports zero.
+func (c *Cluster) replicationLag(ctx context.Context, replica *Connection) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, replica.opts.healthTimeout)
+	defer cancel()
+
+	var inRecovery bool
+	var replayLSN *string
+	var replayAge *float64
+	err := replica.QueryRow(ctx, `SELECT pg_is_in_recovery(),
+		pg_last_wal_replay_lsn()::text,
+		EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())::float8`,
+	).Scan(&inRecovery, &replayLSN, &replayAge)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read replica replay position: %w", err)
+	}
+
+	if !inRecovery {
+		return 0, nil
+	}
+	if replayLSN == nil {
+		return 0, errors.New("replica has not replayed any WAL")
+	}
+
+	var behind int64
+	err = c.primary.QueryRow(ctx,
+		"SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), $1::pg_lsn)::bigint", *replayLSN,
+	).Scan(&behind)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compare replica with primary WAL position: %w", err)
+	}
+
+	if behind <= 0 {
+		return 0, nil
+	}
+	if replayAge == nil {
+		return 0, errors.New("replica has not replayed any transaction")
+	}
+	return time.Duration(*replayAge * float64(time.Second)), nil
+}
+
+// ReplicaStatus is the health of one replica in a Cluster.
+// ReplicationLag is serialized in milliseconds.
+type ReplicaStatus struct {
+	Host           string        `json:"host"`
+	InRotation     bool          `json:"in_rotation"`
+	Message        string        `json:"message"`
+	ReplicationLag time.Duration `json:"replication_lag_ms"`
+	LagKnown       bool          `json:"lag_known"`
+}
+
+// MarshalJSON encodes ReplicationLag as fractional milliseconds.
+func (s ReplicaStatus) MarshalJSON() ([]byte, error) {
+	type plain ReplicaStatus
+	return json.Marshal(struct {
+		plain
+		ReplicationLag float64 `json:"replication_lag_ms"`
+	}{
+		plain:          plain(s),
+		ReplicationLag: float64(s.ReplicationLag) / float64(time.Millisecond),
+	})
+}
+
+// UnmarshalJSON decodes the form written by MarshalJSON.
+func (s *ReplicaStatus) UnmarshalJSON(data []byte) error {
+	type plain ReplicaStatus
+	aux := struct {
+		*plain
+		ReplicationLag float64 `json:"replication_lag_ms"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	s.ReplicationLag = time.Duration(aux.ReplicationLag * float64(time.Millisecond))
+	return nil
+}
+
+// ReplicaStatuses reports the status of each replica as of its last check.
+func (c *Cluster) ReplicaStatuses() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, len(c.replicas))
+	for i, replica := range c.replicas {
+		replica.mu.Lock()
+		status := ReplicaStatus{
+			Host:           fmt.Sprintf("%s:%d", replica.conn.cfg.Host, replica.conn.cfg.Port),
+			InRotation:     replica.healthy.Load(),
+			ReplicationLag: replica.lag,
+			LagKnown:       replica.lagKnown,
+			Message:        "replica is healthy",
+		}
+		switch {
+		case !replica.checked:
+			status.Message = "replica not yet checked"
+		case replica.lastErr != nil:
+			status.Message = replica.lastErr.Error()
+		}
+		replica.mu.Unlock()
+
+		statuses[i] = status
+	}
+	return statuses
+}
+
+// DetailedHealth checks the primary and every replica, returning the
+// primary's status with the status and replication lag of each replica.
+// Overall health follows the primary, since reads fall back to it.
+func (c *Cluster) DetailedHealth(ctx context.Context) *HealthStatus {
+	status := c.primary.DetailedHealth(ctx)
+
+	c.CheckReplicas(ctx)
+	status.Replicas = c.ReplicaStatuses()
+
+	return status
+}
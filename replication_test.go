@@ -0,0 +1,76 @@
+package pgxutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxStaleness(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Zero(t, maxStaleness(ctx))
+	assert.Equal(t, time.Second, maxStaleness(MaxStaleness(ctx, time.Second)))
+}
+
+func TestClusterReplica_Eligible(t *testing.T) {
+	r := &clusterReplica{}
+	assert.False(t, r.eligible(0), "replica out of rotation")
+
+	r.healthy.Store(true)
+	assert.True(t, r.eligible(0))
+	assert.False(t, r.eligible(time.Second), "unknown lag never satisfies a staleness bound")
+
+	r.lag, r.lagKnown = 500*time.Millisecond, true
+	assert.True(t, r.eligible(time.Second))
+	assert.False(t, r.eligible(100*time.Millisecond))
+}
+
+func TestCluster_MaxStalenessRouting(t *testing.T) {
+	cluster := newTestCluster(t, 2)
+	for _, replica := range cluster.replicas {
+		replica.healthy.Store(true)
+		replica.lagKnown = true
+	}
+	cluster.replicas[0].lag = 5 * time.Second
+	cluster.replicas[1].lag = 100 * time.Millisecond
+
+	ctx := MaxStaleness(context.Background(), time.Second)
+	for range 4 {
+		assert.Same(t, cluster.replicas[1].conn, cluster.Reader(ctx))
+	}
+
+	ctx = MaxStaleness(context.Background(), 10*time.Millisecond)
+	assert.Same(t, cluster.Primary(), cluster.Reader(ctx))
+}
+
+func TestWithMaxReplicationLag(t *testing.T) {
+	cluster := newTestCluster(t, 0, WithMaxReplicationLag(time.Second))
+
+	assert.Equal(t, time.Second, cluster.opts.maxLag)
+}
+
+func TestCluster_ReplicaStatuses(t *testing.T) {
+	cluster := newTestCluster(t, 3)
+	cluster.replicas[0].healthy.Store(true)
+	cluster.replicas[0].checked = true
+	cluster.replicas[0].lag, cluster.replicas[0].lagKnown = time.Second, true
+	cluster.replicas[1].checked = true
+	cluster.replicas[1].lastErr = errors.New("health check failed")
+
+	statuses := cluster.ReplicaStatuses()
+
+	assert.Len(t, statuses, 3)
+	assert.Equal(t, "localhost:5432", statuses[0].Host)
+	assert.True(t, statuses[0].InRotation)
+	assert.Equal(t, time.Second, statuses[0].ReplicationLag)
+	assert.True(t, statuses[0].LagKnown)
+	assert.Equal(t, "replica is healthy", statuses[0].Message)
+	assert.False(t, statuses[1].InRotation)
+	assert.Equal(t, "health check failed", statuses[1].Message)
+	assert.False(t, statuses[2].InRotation)
+	assert.Equal(t, "replica not yet checked", statuses[2].Message)
+}
@@ -0,0 +1,422 @@
+package pgxutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// backoff computes exponential delays with full jitter.
+type backoff struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+}
+
+// ceiling returns the un-jittered delay before the given retry (1-based),
+// growing by multiplier each attempt and capped at max.
+func (b backoff) ceiling(attempt int) time.Duration {
+	d := float64(b.initial)
+	for i := 1; i < attempt && d < float64(b.max); i++ {
+		d *= b.multiplier
+	}
+	if d > float64(b.max) {
+		return b.max
+	}
+	return time.Duration(d)
+}
+
+// delay returns a random delay between zero and the ceiling for attempt.
+func (b backoff) delay(attempt int) time.Duration {
+	ceiling := b.ceiling(attempt)
+	if ceiling <= 0 {
+		return 0
+	}
+	// #nosec G404 - jitter does not need a cryptographic source
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// sleepContext waits for d or until ctx is done, returning ctx.Err() in the latter case.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// LogEventQueryRetry is logged before each retry by a RetryingQuerier.
+const LogEventQueryRetry LogEvent = "query_retry"
+
+// ErrAcquireTimeout is returned by a RetryingQuerier when no pooled connection
+// became available within the timeout set by WithRetryAcquireTimeout.
+var ErrAcquireTimeout = errors.New("timed out acquiring connection from pool")
+
+// SQLSTATE codes for server states that clear up on a fresh connection.
+const (
+	sqlStateAdminShutdown    = "57P01"
+	sqlStateCrashShutdown    = "57P02"
+	sqlStateCannotConnectNow = "57P03"
+)
+
+// IsRetryable reports whether err is transient, so that running the statement
+// again on a fresh connection may succeed. That covers:
+//
+//   - serialization failures and deadlocks (40001, 40P01)
+//   - connection exceptions (class 08), admin_shutdown, crash_shutdown and
+//     cannot_connect_now (57P01, 57P02, 57P03)
+//   - connections reset, refused or closed, and network timeouts
+//   - failed connection attempts and errors pgx reports as safe to retry
+//   - ErrAcquireTimeout
+//
+// Context cancellation and deadlines are never retryable, and any other
+// PostgreSQL error is not. Retrying a write is only safe when the statement
+// is idempotent.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrAcquireTimeout) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if code := SQLState(err); code != "" {
+		switch code {
+		case sqlStateSerializationFailure, sqlStateDeadlockDetected,
+			sqlStateAdminShutdown, sqlStateCrashShutdown, sqlStateCannotConnectNow:
+			return true
+		default:
+			return strings.HasPrefix(code, "08")
+		}
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	if errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// idempotentKey marks a context whose Exec calls may be retried.
+type idempotentKey struct{}
+
+// Idempotent returns a context marking Exec calls made with it as safe to run
+// more than once, so a RetryingQuerier retries them on any retryable error.
+//
+// Example usage:
+//
+//	_, err := conn.WithRetry().Exec(pgxutils.Idempotent(ctx),
+//	    "UPDATE users SET email = $1 WHERE id = $2", email, id)
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// RetryOption is a functional option for configuring WithRetry.
+type RetryOption func(*retryOptions)
+
+// retryOptions holds optional configuration for WithRetry.
+type retryOptions struct {
+	maxAttempts    int
+	backoff        backoff
+	acquireTimeout time.Duration
+	onRetry        func(attempt int, err error, delay time.Duration)
+}
+
+// newRetryOptions applies opts over the defaults.
+func newRetryOptions(opts []RetryOption) retryOptions {
+	o := retryOptions{
+		maxAttempts: 3,
+		backoff: backoff{
+			initial:    50 * time.Millisecond,
+			max:        2 * time.Second,
+			multiplier: 2,
+		},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// WithRetryMaxAttempts sets how many times a statement runs in total.
+// Default is 3.
+func WithRetryMaxAttempts(attempts int) RetryOption {
+	return func(opts *retryOptions) {
+		opts.maxAttempts = attempts
+	}
+}
+
+// WithRetryBackoff sets the initial and maximum delay between attempts. The
+// delay doubles each attempt and is fully jittered. Default is 50ms up to 2s.
+func WithRetryBackoff(initial, maxDelay time.Duration) RetryOption {
+	return func(opts *retryOptions) {
+		opts.backoff.initial = initial
+		opts.backoff.max = maxDelay
+	}
+}
+
+// WithRetryAcquireTimeout bounds how long each attempt waits for a pooled
+// connection. An attempt that times out fails with ErrAcquireTimeout and is
+// retried. Default is no bound beyond the caller's context.
+func WithRetryAcquireTimeout(timeout time.Duration) RetryOption {
+	return func(opts *retryOptions) {
+		opts.acquireTimeout = timeout
+	}
+}
+
+// WithRetryHook sets a function called before each retry with the attempt
+// that failed, its error and the delay before the next attempt.
+func WithRetryHook(hook func(attempt int, err error, delay time.Duration)) RetryOption {
+	return func(opts *retryOptions) {
+		opts.onRetry = hook
+	}
+}
+
+// RetryingQuerier runs statements on a Connection, re-running them with
+// jittered exponential backoff when they fail with a retryable error.
+//
+// Query and QueryRow are treated as reads and retried on any error IsRetryable
+// accepts. Exec is retried on those errors only when its context is marked
+// with Idempotent; otherwise only when the statement never reached the server.
+// Errors surfaced later through Rows are not retried. SendBatch and CopyFrom
+// run once.
+//
+// When ctx carries a transaction (see ContextWithTx) statements run once on
+// that transaction, since only its owner can re-run it.
+type RetryingQuerier struct {
+	db     *Connection
+	events eventLogger
+	opts   retryOptions
+}
+
+var _ Querier = (*RetryingQuerier)(nil)
+
+// WithRetry returns a Querier that retries transient failures.
+//
+// Example usage:
+//
+//	var name string
+//	err := conn.WithRetry(pgxutils.WithRetryMaxAttempts(5)).
+//	    QueryRow(ctx, "SELECT name FROM users WHERE id = $1", id).Scan(&name)
+func (db *Connection) WithRetry(opts ...RetryOption) *RetryingQuerier {
+	return &RetryingQuerier{
+		db:     db,
+		events: db.events(),
+		opts:   newRetryOptions(opts),
+	}
+}
+
+// Exec executes a statement, retrying it as described on RetryingQuerier.
+func (r *RetryingQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.Exec(ctx, sql, args...)
+	}
+
+	idempotent := isIdempotent(ctx)
+	sent := false
+	retryable := func(err error) bool {
+		return IsRetryable(err) && (idempotent || !sent || pgconn.SafeToRetry(err))
+	}
+
+	var tag pgconn.CommandTag
+	err := r.retry(ctx, retryable, func() error {
+		sent = false
+		conn, err := r.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+
+		sent = true
+		tag, err = conn.Exec(ctx, sql, args...)
+		return err
+	})
+	return tag, r.db.classify(err)
+}
+
+// Query executes a query returning multiple rows, retrying it as described on
+// RetryingQuerier.
+func (r *RetryingQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.Query(ctx, sql, args...)
+	}
+
+	var rows pgx.Rows
+	err := r.retry(ctx, IsRetryable, func() error {
+		conn, err := r.acquire(ctx)
+		if err != nil {
+			return err
+		}
+
+		result, err := conn.Query(ctx, sql, args...)
+		if err != nil {
+			conn.Release()
+			return err
+		}
+		rows = &releasingRows{Rows: result, conn: conn}
+		return nil
+	})
+	if err != nil {
+		return nil, r.db.classify(err)
+	}
+	if r.db.opts.classifyErrors {
+		return classifyingRows{Rows: rows}, nil
+	}
+	return rows, nil
+}
+
+// QueryRow executes a query expecting a single row. The query runs, and is
+// retried as described on RetryingQuerier, when Scan is called.
+func (r *RetryingQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.QueryRow(ctx, sql, args...)
+	}
+	return &retryingRow{querier: r, ctx: ctx, sql: sql, args: args}
+}
+
+// SendBatch sends a batch of queries once, without retrying.
+func (r *RetryingQuerier) SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults {
+	return r.db.FromContext(ctx).SendBatch(ctx, batch)
+}
+
+// CopyFrom copies rows into a table once, without retrying.
+func (r *RetryingQuerier) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return r.db.FromContext(ctx).CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+// acquire takes a connection from the pool, bounded by the acquire timeout.
+func (r *RetryingQuerier) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	h, err := r.db.usePool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer h.release()
+
+	if r.opts.acquireTimeout <= 0 {
+		return h.pool.Acquire(ctx)
+	}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, r.opts.acquireTimeout)
+	defer cancel()
+
+	conn, err := h.pool.Acquire(acquireCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after %s", ErrAcquireTimeout, r.opts.acquireTimeout)
+	}
+	return conn, err
+}
+
+// retry calls run until it succeeds, fails with an error retryable rejects,
+// exhausts its attempts, or ctx is done. The last error from run is returned.
+func (r *RetryingQuerier) retry(ctx context.Context, retryable func(error) bool, run func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || attempt >= r.opts.maxAttempts || !retryable(err) {
+			return err
+		}
+
+		delay := r.opts.backoff.delay(attempt)
+		if r.opts.onRetry != nil {
+			r.opts.onRetry(attempt, err, delay)
+		}
+		r.events.log(
+			ctx,
+			LogEventQueryRetry,
+			slog.LevelInfo,
+			"retrying query",
+			"attempt", attempt,
+			"delay", delay,
+			"error", err,
+		)
+
+		if sleepContext(ctx, delay) != nil {
+			return err
+		}
+	}
+}
+
+// retryingRow defers a RetryingQuerier QueryRow until Scan.
+type retryingRow struct {
+	querier *RetryingQuerier
+	ctx     context.Context
+	sql     string
+	args    []any
+}
+
+func (row *retryingRow) Scan(dest ...any) error {
+	r := row.querier
+	err := r.retry(row.ctx, IsRetryable, func() error {
+		conn, err := r.acquire(row.ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+
+		return conn.QueryRow(row.ctx, row.sql, row.args...).Scan(dest...)
+	})
+	return r.db.classify(err)
+}
+
+// releasingRows returns its connection to the pool once the rows are closed
+// or exhausted, like the rows returned by pgxpool.Pool.Query.
+type releasingRows struct {
+	pgx.Rows
+	conn     *pgxpool.Conn
+	released bool
+}
+
+func (r *releasingRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.Close()
+	return false
+}
+
+func (r *releasingRows) Close() {
+	r.Rows.Close()
+	if !r.released {
+		r.released = true
+		r.conn.Release()
+	}
+}
@@ -0,0 +1,182 @@
+package pgxutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff_Ceiling(t *testing.T) {
+	b := backoff{initial: 10 * time.Millisecond, max: 100 * time.Millisecond, multiplier: 2}
+
+	assert.Equal(t, 10*time.Millisecond, b.ceiling(1))
+	assert.Equal(t, 20*time.Millisecond, b.ceiling(2))
+	assert.Equal(t, 40*time.Millisecond, b.ceiling(3))
+	assert.Equal(t, 100*time.Millisecond, b.ceiling(5))
+	assert.Equal(t, 100*time.Millisecond, b.ceiling(1000))
+}
+
+func TestBackoff_DelayWithinCeiling(t *testing.T) {
+	b := backoff{initial: 10 * time.Millisecond, max: 100 * time.Millisecond, multiplier: 2}
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := b.delay(attempt)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, b.ceiling(attempt))
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	t.Run("elapses", func(t *testing.T) {
+		require.NoError(t, sleepContext(context.Background(), time.Millisecond))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		start := time.Now()
+		err := sleepContext(ctx, time.Hour)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"cannot connect now", &pgconn.PgError{Code: "57P03"}, true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"acquire timeout", fmt.Errorf("%w after 1s", ErrAcquireTimeout), true},
+		{"context canceled", context.Canceled, false},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+		{"no rows", pgx.ErrNoRows, false},
+		{"plain error", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	ctx := context.Background()
+
+	assert.False(t, isIdempotent(ctx))
+	assert.True(t, isIdempotent(Idempotent(ctx)))
+}
+
+func TestNewRetryOptions_Defaults(t *testing.T) {
+	o := newRetryOptions(nil)
+
+	assert.Equal(t, 3, o.maxAttempts)
+	assert.Equal(t, 50*time.Millisecond, o.backoff.initial)
+	assert.Equal(t, 2*time.Second, o.backoff.max)
+	assert.Zero(t, o.acquireTimeout)
+}
+
+func newTestRetryingQuerier(t *testing.T, opts ...RetryOption) *RetryingQuerier {
+	t.Helper()
+
+	conn, err := NewConnection(baseConfig())
+	require.NoError(t, err)
+	return conn.WithRetry(append([]RetryOption{WithRetryBackoff(time.Millisecond, time.Millisecond)}, opts...)...)
+}
+
+func TestRetryingQuerier_RetriesUntilSuccess(t *testing.T) {
+	var retries []int
+	r := newTestRetryingQuerier(t, WithRetryHook(func(attempt int, err error, delay time.Duration) {
+		retries = append(retries, attempt)
+	}))
+
+	calls := 0
+	err := r.retry(context.Background(), IsRetryable, func() error {
+		calls++
+		if calls < 3 {
+			return &pgconn.PgError{Code: "57P01"}
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 2}, retries)
+}
+
+func TestRetryingQuerier_StopsAfterMaxAttempts(t *testing.T) {
+	r := newTestRetryingQuerier(t, WithRetryMaxAttempts(2))
+
+	calls := 0
+	err := r.retry(context.Background(), IsRetryable, func() error {
+		calls++
+		return &pgconn.PgError{Code: "57P03"}
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "57P03", SQLState(err))
+}
+
+func TestRetryingQuerier_StopsOnNonRetryableError(t *testing.T) {
+	r := newTestRetryingQuerier(t)
+
+	calls := 0
+	err := r.retry(context.Background(), IsRetryable, func() error {
+		calls++
+		return &pgconn.PgError{Code: "23505"}
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryingQuerier_RespectsContextCancellation(t *testing.T) {
+	r := newTestRetryingQuerier(t, WithRetryBackoff(time.Hour, time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := r.retry(ctx, IsRetryable, func() error {
+		calls++
+		cancel()
+		return &pgconn.PgError{Code: "57P01"}
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryingQuerier_PoolNotInitialized(t *testing.T) {
+	r := newTestRetryingQuerier(t)
+	ctx := context.Background()
+
+	_, err := r.Exec(ctx, "SELECT 1")
+	assert.Error(t, err)
+
+	_, err = r.Query(ctx, "SELECT 1")
+	assert.Error(t, err)
+
+	var n int
+	err = r.QueryRow(ctx, "SELECT 1").Scan(&n)
+	assert.Error(t, err)
+}
@@ -0,0 +1,218 @@
+package pgxutils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LogEventShutdown is logged when Shutdown has closed the pool.
+const LogEventShutdown LogEvent = "shutdown"
+
+// ErrShuttingDown is returned by Connection methods called after Shutdown has
+// started, instead of handing out a connection.
+var ErrShuttingDown = errors.New("database connection is shutting down")
+
+// errPoolNotInitialized is returned by Connection methods called before Connect.
+var errPoolNotInitialized = errors.New("database pool not initialized")
+
+// connRegistry records the open physical connections of one pool, and which
+// of them are acquired, so that Shutdown can find the ones still in use when it
+// runs out of time.
+type connRegistry struct {
+	mu    sync.Mutex
+	conns map[*pgx.Conn]bool // true while acquired
+}
+
+// track returns a copy of poolConfig whose hooks and tracer record the pool's
+// connections in r.
+func (r *connRegistry) track(poolConfig *pgxpool.Config) *pgxpool.Config {
+	poolConfig = poolConfig.Copy()
+	poolConfig.AfterConnect = r.afterConnect
+	poolConfig.BeforeClose = r.beforeClose
+
+	var tracers []pgx.QueryTracer
+	switch t := poolConfig.ConnConfig.Tracer.(type) {
+	case nil:
+	case multiTracer:
+		tracers = append(tracers, t...)
+	default:
+		tracers = append(tracers, t)
+	}
+	poolConfig.ConnConfig.Tracer = combineTracers(append(tracers, r))
+	return poolConfig
+}
+
+// afterConnect is installed as the pool's AfterConnect hook.
+func (r *connRegistry) afterConnect(_ context.Context, conn *pgx.Conn) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conns == nil {
+		r.conns = make(map[*pgx.Conn]bool)
+	}
+	r.conns[conn] = false
+	return nil
+}
+
+// beforeClose is installed as the pool's BeforeClose hook.
+func (r *connRegistry) beforeClose(conn *pgx.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.conns, conn)
+}
+
+// setAcquired marks a registered connection as acquired or released.
+func (r *connRegistry) setAcquired(conn *pgx.Conn, acquired bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.conns[conn]; ok {
+		r.conns[conn] = acquired
+	}
+}
+
+// TraceQueryStart implements pgx.QueryTracer; queries are not recorded.
+func (r *connRegistry) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (r *connRegistry) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// TraceAcquireStart implements pgxpool.AcquireTracer.
+func (r *connRegistry) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return ctx
+}
+
+// TraceAcquireEnd implements pgxpool.AcquireTracer.
+func (r *connRegistry) TraceAcquireEnd(_ context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	if data.Conn != nil {
+		r.setAcquired(data.Conn, true)
+	}
+}
+
+// TraceRelease implements pgxpool.ReleaseTracer. It runs before the connection
+// is returned to the pool.
+func (r *connRegistry) TraceRelease(_ *pgxpool.Pool, data pgxpool.TraceReleaseData) {
+	r.setAcquired(data.Conn, false)
+}
+
+// acquired returns the registered connections that are acquired and have not
+// been closed. A connection hijacked from the pool stays acquired until it is
+// closed.
+func (r *connRegistry) acquired() []*pgx.Conn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conns := make([]*pgx.Conn, 0, len(r.conns))
+	for conn, acquired := range r.conns {
+		if !acquired {
+			continue
+		}
+		// Unlike IsClosed, CleanupDone is safe to check while the connection
+		// is in use by another goroutine
+		select {
+		case <-conn.PgConn().CleanupDone():
+		default:
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// Shutdown closes the pool gracefully, for use when the process is asked to stop.
+//
+// New work is refused straight away: Connection methods return ErrShuttingDown.
+// Shutdown then waits, until ctx is done, for acquired connections to be
+// released, which includes running queries and open transactions finishing.
+// Idle connections are closed straight away.
+//
+// Connections still in use when ctx is done are closed under their holders,
+// whose queries fail and whose transactions are rolled back by the server.
+// Shutdown returns once the holders have released them. The number interrupted
+// is returned, along with a timeout error when it is not zero.
+//
+// Without a pool, Shutdown does nothing. Connect may be called again afterwards.
+func (c *Connection) Shutdown(ctx context.Context) (int, error) {
+	start := time.Now()
+
+	c.shuttingDown.Store(true)
+	c.stopConnecting()
+	h := c.pool.Swap(nil)
+	if h == nil {
+		return 0, nil
+	}
+
+	// Callers that took the pool before the swap may still be acquiring from
+	// it, but idle connections need not wait for them
+	h.retire()
+	h.pool.Reset()
+	select {
+	case <-h.idle:
+	case <-ctx.Done():
+	}
+
+	// Closing the pool closes its idle connections at once, then waits for
+	// acquired ones to be released
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		h.pool.Close()
+	}()
+
+	var interrupted []*pgx.Conn
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		interrupted = h.conns.acquired()
+		for _, conn := range interrupted {
+			// Closing the socket is safe while another goroutine is using the
+			// connection and makes its current operation fail
+			_ = conn.PgConn().Conn().Close()
+		}
+		<-closed
+	}
+
+	c.events().log(
+		ctx,
+		LogEventShutdown,
+		slog.LevelInfo,
+		"database connection shut down",
+		"interrupted", len(interrupted),
+		"duration", time.Since(start),
+	)
+
+	if len(interrupted) > 0 {
+		return len(interrupted), errors.NewTimeoutError(
+			fmt.Sprintf("shutdown interrupted %d connections still in use", len(interrupted)),
+			"database_shutdown",
+			time.Since(start),
+			errors.WithCause(ctx.Err()),
+		)
+	}
+	return 0, nil
+}
+
+// notConnectedError explains why there is no pool to use.
+func (c *Connection) notConnectedError() error {
+	if c.shuttingDown.Load() {
+		return ErrShuttingDown
+	}
+	if bg := c.connecting.Load(); bg != nil {
+		if !bg.finished() {
+			return ErrNotReady
+		}
+		if bg.err != nil {
+			return fmt.Errorf("%w: %w", ErrNotReady, bg.err)
+		}
+	}
+	return errPoolNotInitialized
+}
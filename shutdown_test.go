@@ -0,0 +1,236 @@
+package pgxutils
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown_NotConnected(t *testing.T) {
+	conn := unreachableConnection(t)
+
+	interrupted, err := conn.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, interrupted)
+}
+
+func TestShutdown_RefusesNewWork(t *testing.T) {
+	conn := unreachableConnection(t)
+	pool := lazyPool(t, conn)
+	conn.pool.Store(newPoolHandle(pool, &connRegistry{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	interrupted, err := conn.Shutdown(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, interrupted)
+	assert.True(t, poolClosed(pool))
+	assert.Nil(t, conn.Pool())
+
+	_, err = conn.Exec(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, ErrShuttingDown)
+	_, err = conn.Query(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, ErrShuttingDown)
+	assert.ErrorIs(t, conn.QueryRow(ctx, "SELECT 1").Scan(), ErrShuttingDown)
+	_, err = conn.Begin(ctx)
+	assert.ErrorIs(t, err, ErrShuttingDown)
+	_, err = conn.Acquire(ctx)
+	assert.ErrorIs(t, err, ErrShuttingDown)
+	assert.ErrorIs(t, conn.WithTransaction(ctx, func(pgx.Tx) error { return nil }), ErrShuttingDown)
+	assert.ErrorIs(t, conn.Health(ctx), ErrShuttingDown)
+	assert.ErrorIs(t, conn.ResetPool(ctx), ErrShuttingDown)
+}
+
+func TestShutdown_WaitsForPoolUsers(t *testing.T) {
+	conn := unreachableConnection(t)
+	conn.pool.Store(newPoolHandle(lazyPool(t, conn), &connRegistry{}))
+
+	// A caller that took the pool before Shutdown may still acquire from it
+	h, err := conn.usePool(context.Background())
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = conn.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned while the pool was still in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.False(t, poolClosed(h.pool))
+
+	h.release()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return once the pool was released")
+	}
+}
+
+// stallingServer accepts PostgreSQL connections and answers pings, but never
+// answers any other query.
+func stallingServer(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveStalling(c)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func serveStalling(c net.Conn) {
+	defer func() { _ = c.Close() }()
+
+	backend := pgproto3.NewBackend(c, c)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: []byte{0, 0, 0, 1}})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := backend.Flush(); err != nil {
+		return
+	}
+
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			if !strings.HasPrefix(msg.String, "--") {
+				continue
+			}
+			backend.Send(&pgproto3.EmptyQueryResponse{})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if err := backend.Flush(); err != nil {
+				return
+			}
+		case *pgproto3.Terminate:
+			return
+		}
+	}
+}
+
+func TestShutdown_InterruptsAtDeadline(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = stallingServer(t)
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(context.Background()))
+	t.Cleanup(conn.Close)
+
+	queryErr := make(chan error, 1)
+	go func() {
+		_, err := conn.Exec(context.Background(), "SELECT pg_sleep(30)")
+		queryErr <- err
+	}()
+	require.Eventually(t, func() bool {
+		return conn.Stats().AcquiredConns() == 1
+	}, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	var interrupted int
+	go func() {
+		defer close(done)
+		interrupted, err = conn.Shutdown(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return after its deadline")
+	}
+	assert.Equal(t, 1, interrupted)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "interrupted 1 connections")
+	assert.Error(t, <-queryErr, "the interrupted query should fail")
+}
+
+func TestShutdown_ExpiredContextWithIdleConnections(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = stallingServer(t)
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(context.Background()))
+	t.Cleanup(conn.Close)
+
+	// Leave several connections idle in the pool
+	acquired := make([]*ConnectionWrapper, 3)
+	for i := range acquired {
+		acquired[i], err = conn.Acquire(context.Background())
+		require.NoError(t, err)
+	}
+	for _, c := range acquired {
+		c.Release()
+	}
+	require.Eventually(t, func() bool {
+		return conn.Stats().IdleConns() == 3
+	}, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	interrupted, err := conn.Shutdown(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, interrupted)
+}
+
+func TestConnRegistry_TracksAcquiredConnections(t *testing.T) {
+	cfg := baseConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = stallingServer(t)
+	conn, err := NewConnection(cfg)
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect(context.Background()))
+	t.Cleanup(conn.Close)
+
+	h := conn.pool.Load()
+	assert.Empty(t, h.conns.acquired())
+
+	c, err := conn.Acquire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*pgx.Conn{c.Conn().Conn()}, h.conns.acquired())
+
+	// A replacement pool has a registry of its own
+	require.NoError(t, conn.ResetPool(context.Background()))
+	assert.Empty(t, conn.pool.Load().conns.acquired())
+
+	c.Release()
+	assert.Empty(t, h.conns.acquired())
+}
+
+func TestNotConnectedError(t *testing.T) {
+	conn := unreachableConnection(t)
+	_, err := conn.Exec(context.Background(), "SELECT 1")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrShuttingDown)
+	assert.Contains(t, err.Error(), "database pool not initialized")
+}
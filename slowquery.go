@@ -0,0 +1,423 @@
+package pgxutils
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LogEventSlowQuery is logged for each reported slow statement.
+const LogEventSlowQuery LogEvent = "slow_query"
+
+// SlowQuery describes a statement that exceeded the slow-query threshold.
+//
+// Argument values are never included; only their count is reported.
+type SlowQuery struct {
+	SQL         string        // normalized SQL with literals replaced by "?"
+	Fingerprint string        // stable hash of SQL, used for rate limiting
+	ArgCount    int           // number of arguments, values redacted
+	Duration    time.Duration // statement duration
+	AcquireWait time.Duration // time spent acquiring the connection from the pool
+	Caller      runtime.Frame // first stack frame outside pgx and this package
+	Err         error         // statement error, if any
+	Suppressed  int           // reports dropped by the rate limit since the last one
+}
+
+// slowQueryOptions holds the slow-query detector configuration.
+type slowQueryOptions struct {
+	threshold  time.Duration
+	sampleRate float64
+	rateLimit  time.Duration
+	handler    func(context.Context, SlowQuery)
+}
+
+// WithSlowQueryThreshold reports every statement that takes longer than threshold.
+// Reports are logged at WARN as LogEventSlowQuery unless WithSlowQueryHandler is set.
+// Disabled by default.
+func WithSlowQueryThreshold(threshold time.Duration) Option {
+	return func(opts *connectionOptions) {
+		opts.slowQuery.threshold = threshold
+	}
+}
+
+// WithSlowQuerySampleRate reports only the given fraction (0 to 1) of slow statements.
+// Default is 1, reporting every slow statement.
+func WithSlowQuerySampleRate(rate float64) Option {
+	return func(opts *connectionOptions) {
+		opts.slowQuery.sampleRate = rate
+	}
+}
+
+// WithSlowQueryRateLimit reports each distinct statement at most once per interval.
+// Default is one minute; zero disables rate limiting.
+func WithSlowQueryRateLimit(interval time.Duration) Option {
+	return func(opts *connectionOptions) {
+		opts.slowQuery.rateLimit = interval
+	}
+}
+
+// WithSlowQueryHandler replaces logging of slow statements with a custom handler.
+func WithSlowQueryHandler(handler func(context.Context, SlowQuery)) Option {
+	return func(opts *connectionOptions) {
+		opts.slowQuery.handler = handler
+	}
+}
+
+// maxSlowQueryFingerprints bounds the rate-limit state before stale entries are pruned.
+const maxSlowQueryFingerprints = 1024
+
+// slowQueryTracer measures statements and reports those above the threshold.
+// Batches and COPY FROM are measured as a whole and reported as one statement.
+//
+// It implements pgxpool.AcquireTracer and pgxpool.ReleaseTracer to attribute
+// the acquire wait to the connection a statement runs on.
+type slowQueryTracer struct {
+	opts   slowQueryOptions
+	events eventLogger
+
+	acquireWaits sync.Map // *pgx.Conn -> time.Duration
+
+	mu       sync.Mutex
+	lastSeen map[string]*slowQueryLimit
+}
+
+// slowQueryLimit is the rate-limit state of one fingerprint.
+type slowQueryLimit struct {
+	reported   time.Time
+	suppressed int
+}
+
+var (
+	_ pgx.QueryTracer       = (*slowQueryTracer)(nil)
+	_ pgx.BatchTracer       = (*slowQueryTracer)(nil)
+	_ pgx.CopyFromTracer    = (*slowQueryTracer)(nil)
+	_ pgxpool.AcquireTracer = (*slowQueryTracer)(nil)
+	_ pgxpool.ReleaseTracer = (*slowQueryTracer)(nil)
+)
+
+func newSlowQueryTracer(opts slowQueryOptions, events eventLogger) *slowQueryTracer {
+	return &slowQueryTracer{
+		opts:     opts,
+		events:   events,
+		lastSeen: make(map[string]*slowQueryLimit),
+	}
+}
+
+// slowQueryKey stores the start of a statement in the context.
+type slowQueryKey struct{}
+
+// slowQueryAcquireKey stores the start of a pool acquire in the context.
+type slowQueryAcquireKey struct{}
+
+type slowQueryStart struct {
+	sql         string
+	argCount    int
+	start       time.Time
+	acquireWait time.Duration
+}
+
+// begin records the start of a statement.
+func (t *slowQueryTracer) begin(ctx context.Context, conn *pgx.Conn, sql string, argCount int) context.Context {
+	start := slowQueryStart{
+		sql:      sql,
+		argCount: argCount,
+		start:    time.Now(),
+	}
+
+	if conn != nil {
+		if wait, ok := t.acquireWaits.Load(conn); ok {
+			start.acquireWait = wait.(time.Duration)
+		}
+	}
+
+	return context.WithValue(ctx, slowQueryKey{}, start)
+}
+
+// end reports the statement started by begin if it exceeded the threshold.
+func (t *slowQueryTracer) end(ctx context.Context, err error) {
+	start, ok := ctx.Value(slowQueryKey{}).(slowQueryStart)
+	if !ok {
+		return
+	}
+
+	duration := time.Since(start.start)
+	if duration <= t.opts.threshold {
+		return
+	}
+
+	// #nosec G404 - sampling does not need a cryptographic source
+	if t.opts.sampleRate < 1 && rand.Float64() >= t.opts.sampleRate {
+		return
+	}
+
+	// The end hooks run on the caller's goroutine, so the stack still leads to
+	// the caller; capturing it here costs nothing for fast statements.
+	callers := make([]uintptr, 32)
+	callers = callers[:runtime.Callers(2, callers)]
+
+	sql := normalizeSQL(start.sql)
+	fingerprint := sqlFingerprint(sql)
+
+	suppressed, allowed := t.allow(fingerprint, time.Now())
+	if !allowed {
+		return
+	}
+
+	t.report(ctx, SlowQuery{
+		SQL:         sql,
+		Fingerprint: fingerprint,
+		ArgCount:    start.argCount,
+		Duration:    duration,
+		AcquireWait: start.acquireWait,
+		Caller:      callerFrame(callers),
+		Err:         err,
+		Suppressed:  suppressed,
+	})
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *slowQueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return t.begin(ctx, conn, data.SQL, len(data.Args))
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *slowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.end(ctx, data.Err)
+}
+
+// TraceBatchStart implements pgx.BatchTracer. The batch is reported as its
+// statements joined by "; ".
+func (t *slowQueryTracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	var (
+		statements []string
+		argCount   int
+	)
+	if data.Batch != nil {
+		for _, query := range data.Batch.QueuedQueries {
+			statements = append(statements, query.SQL)
+			argCount += len(query.Arguments)
+		}
+	}
+	return t.begin(ctx, conn, strings.Join(statements, "; "), argCount)
+}
+
+// TraceBatchQuery implements pgx.BatchTracer. Batch statements have no
+// duration of their own.
+func (t *slowQueryTracer) TraceBatchQuery(context.Context, *pgx.Conn, pgx.TraceBatchQueryData) {}
+
+// TraceBatchEnd implements pgx.BatchTracer.
+func (t *slowQueryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	t.end(ctx, data.Err)
+}
+
+// TraceCopyFromStart implements pgx.CopyFromTracer.
+func (t *slowQueryTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return t.begin(ctx, conn, "COPY "+data.TableName.Sanitize(), 0)
+}
+
+// TraceCopyFromEnd implements pgx.CopyFromTracer.
+func (t *slowQueryTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.end(ctx, data.Err)
+}
+
+// TraceAcquireStart implements pgxpool.AcquireTracer.
+func (t *slowQueryTracer) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return context.WithValue(ctx, slowQueryAcquireKey{}, time.Now())
+}
+
+// TraceAcquireEnd implements pgxpool.AcquireTracer.
+func (t *slowQueryTracer) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	started, ok := ctx.Value(slowQueryAcquireKey{}).(time.Time)
+	if !ok || data.Conn == nil {
+		return
+	}
+	t.acquireWaits.Store(data.Conn, time.Since(started))
+}
+
+// TraceRelease implements pgxpool.ReleaseTracer.
+func (t *slowQueryTracer) TraceRelease(_ *pgxpool.Pool, data pgxpool.TraceReleaseData) {
+	if data.Conn != nil {
+		t.acquireWaits.Delete(data.Conn)
+	}
+}
+
+// allow applies the per-fingerprint rate limit, returning how many reports were
+// suppressed since the last one and whether this one may be reported.
+func (t *slowQueryTracer) allow(fingerprint string, now time.Time) (int, bool) {
+	if t.opts.rateLimit <= 0 {
+		return 0, true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limit, ok := t.lastSeen[fingerprint]
+	if ok && now.Sub(limit.reported) < t.opts.rateLimit {
+		limit.suppressed++
+		return 0, false
+	}
+
+	if !ok {
+		if len(t.lastSeen) >= maxSlowQueryFingerprints {
+			t.pruneLocked(now)
+		}
+		limit = &slowQueryLimit{}
+		t.lastSeen[fingerprint] = limit
+	}
+
+	suppressed := limit.suppressed
+	limit.reported = now
+	limit.suppressed = 0
+	return suppressed, true
+}
+
+// pruneLocked drops fingerprints whose rate-limit window has passed.
+// Suppressed counts for dropped fingerprints are lost.
+func (t *slowQueryTracer) pruneLocked(now time.Time) {
+	for fingerprint, limit := range t.lastSeen {
+		if now.Sub(limit.reported) >= t.opts.rateLimit {
+			delete(t.lastSeen, fingerprint)
+		}
+	}
+}
+
+func (t *slowQueryTracer) report(ctx context.Context, q SlowQuery) {
+	if t.opts.handler != nil {
+		t.opts.handler(ctx, q)
+		return
+	}
+
+	args := []any{
+		"sql", q.SQL,
+		"fingerprint", q.Fingerprint,
+		"args", q.ArgCount,
+		"duration", q.Duration,
+		"threshold", t.opts.threshold,
+		"acquire_wait", q.AcquireWait,
+	}
+	if q.Caller.File != "" {
+		args = append(args,
+			"caller", fmt.Sprintf("%s:%d", q.Caller.File, q.Caller.Line),
+			"function", q.Caller.Function,
+		)
+	}
+	if q.Suppressed > 0 {
+		args = append(args, "suppressed", q.Suppressed)
+	}
+	if q.Err != nil {
+		args = append(args, "error", q.Err)
+	}
+
+	t.events.log(ctx, LogEventSlowQuery, slog.LevelWarn, "slow query", args...)
+}
+
+// modulePrefix is the function name prefix of this package; subpackages use "/".
+const modulePrefix = "github.com/JohnPlummer/jp-go-pgx-utils."
+
+// callerFrame returns the first frame outside pgx, this package and the runtime.
+// Frames from this package's tests count as callers.
+func callerFrame(pcs []uintptr) runtime.Frame {
+	if len(pcs) == 0 {
+		return runtime.Frame{}
+	}
+
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		internal := strings.HasPrefix(frame.Function, "github.com/jackc/pgx/") ||
+			strings.HasPrefix(frame.Function, "runtime.") ||
+			(strings.HasPrefix(frame.Function, modulePrefix) && !strings.HasSuffix(frame.File, "_test.go"))
+		if !internal {
+			return frame
+		}
+		if !more {
+			return runtime.Frame{}
+		}
+	}
+}
+
+// sqlFingerprint hashes normalized SQL into a short stable identifier.
+func sqlFingerprint(normalized string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(normalized))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// normalizeSQL replaces string and numeric literals with "?" and collapses
+// whitespace, so statements differing only in literals share a fingerprint.
+// Placeholders such as $1 and identifiers containing digits are kept.
+func normalizeSQL(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+
+	pendingSpace := false
+	prevIdent := false
+
+	write := func(s string) {
+		if pendingSpace && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		pendingSpace = false
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			pendingSpace = true
+			prevIdent = false
+			i++
+		case c == '\'':
+			i = skipQuoted(sql, i)
+			write("?")
+			prevIdent = false
+		case isDigit(c) && !prevIdent:
+			for i < len(sql) && (isDigit(sql[i]) || sql[i] == '.') {
+				i++
+			}
+			write("?")
+			prevIdent = false
+		default:
+			write(sql[i : i+1])
+			prevIdent = isIdentByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// skipQuoted returns the index just past the single-quoted literal starting at i.
+// A doubled quote inside the literal is an escaped quote.
+func skipQuoted(sql string, i int) int {
+	for i++; i < len(sql); i++ {
+		if sql[i] != '\'' {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == '\'' {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(sql)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
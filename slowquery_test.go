@@ -0,0 +1,195 @@
+package pgxutils
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{name: "string literal", sql: "SELECT * FROM users WHERE name = 'alice'", want: "SELECT * FROM users WHERE name = ?"},
+		{name: "escaped quote", sql: "SELECT 'it''s'", want: "SELECT ?"},
+		{name: "numbers", sql: "SELECT * FROM t LIMIT 10 OFFSET 2.5", want: "SELECT * FROM t LIMIT ? OFFSET ?"},
+		{name: "placeholders kept", sql: "SELECT * FROM t WHERE id = $1", want: "SELECT * FROM t WHERE id = $1"},
+		{name: "identifiers with digits kept", sql: "SELECT col1 FROM t2", want: "SELECT col1 FROM t2"},
+		{name: "whitespace collapsed", sql: "  SELECT\n\t1  ", want: "SELECT ?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeSQL(tt.sql))
+		})
+	}
+}
+
+func TestSQLFingerprint_IgnoresLiterals(t *testing.T) {
+	a := sqlFingerprint(normalizeSQL("SELECT * FROM users WHERE id = 1"))
+	b := sqlFingerprint(normalizeSQL("SELECT * FROM users WHERE id = 42"))
+	c := sqlFingerprint(normalizeSQL("SELECT * FROM orders WHERE id = 1"))
+
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
+
+func newTestSlowQueryTracer(handler func(context.Context, SlowQuery)) *slowQueryTracer {
+	return newSlowQueryTracer(slowQueryOptions{
+		threshold:  time.Millisecond,
+		sampleRate: 1,
+		rateLimit:  time.Minute,
+		handler:    handler,
+	}, newEventLogger(nil, nil))
+}
+
+func runSlowQuery(tracer *slowQueryTracer, sql string, args ...any) {
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql, Args: args})
+	time.Sleep(5 * time.Millisecond)
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+}
+
+func TestSlowQueryTracer_ReportsSlowStatement(t *testing.T) {
+	var reports []SlowQuery
+	tracer := newTestSlowQueryTracer(func(_ context.Context, q SlowQuery) {
+		reports = append(reports, q)
+	})
+
+	runSlowQuery(tracer, "SELECT * FROM users WHERE email = 'secret@example.com' AND id = $1", 7)
+
+	require.Len(t, reports, 1)
+	q := reports[0]
+	assert.Equal(t, "SELECT * FROM users WHERE email = ? AND id = $1", q.SQL)
+	assert.Equal(t, 1, q.ArgCount)
+	assert.GreaterOrEqual(t, q.Duration, 5*time.Millisecond)
+	assert.True(t, strings.HasSuffix(q.Caller.File, "slowquery_test.go"), q.Caller.File)
+}
+
+func TestSlowQueryTracer_ReportsSlowBatch(t *testing.T) {
+	var reports []SlowQuery
+	tracer := newTestSlowQueryTracer(func(_ context.Context, q SlowQuery) {
+		reports = append(reports, q)
+	})
+
+	batch := &pgx.Batch{}
+	batch.Queue("INSERT INTO users (email) VALUES ($1)", "a@example.com")
+	batch.Queue("UPDATE users SET active = true WHERE id = 42")
+
+	ctx := tracer.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{Batch: batch})
+	tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "INSERT INTO users (email) VALUES ($1)"})
+	time.Sleep(5 * time.Millisecond)
+	tracer.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{})
+
+	require.Len(t, reports, 1)
+	q := reports[0]
+	assert.Equal(t, "INSERT INTO users (email) VALUES ($1); UPDATE users SET active = true WHERE id = ?", q.SQL)
+	assert.Equal(t, 1, q.ArgCount)
+	assert.GreaterOrEqual(t, q.Duration, 5*time.Millisecond)
+	assert.True(t, strings.HasSuffix(q.Caller.File, "slowquery_test.go"), q.Caller.File)
+}
+
+func TestSlowQueryTracer_ReportsSlowCopyFrom(t *testing.T) {
+	var reports []SlowQuery
+	tracer := newTestSlowQueryTracer(func(_ context.Context, q SlowQuery) {
+		reports = append(reports, q)
+	})
+
+	ctx := tracer.TraceCopyFromStart(context.Background(), nil, pgx.TraceCopyFromStartData{
+		TableName: pgx.Identifier{"users"},
+	})
+	time.Sleep(5 * time.Millisecond)
+	tracer.TraceCopyFromEnd(ctx, nil, pgx.TraceCopyFromEndData{})
+
+	require.Len(t, reports, 1)
+	assert.Equal(t, `COPY "users"`, reports[0].SQL)
+}
+
+func TestSlowQueryTracer_IgnoresFastStatement(t *testing.T) {
+	var reports []SlowQuery
+	tracer := newTestSlowQueryTracer(func(_ context.Context, q SlowQuery) {
+		reports = append(reports, q)
+	})
+	tracer.opts.threshold = time.Hour
+
+	runSlowQuery(tracer, "SELECT 1")
+
+	assert.Empty(t, reports)
+}
+
+func TestSlowQueryTracer_RateLimitsPerFingerprint(t *testing.T) {
+	var reports []SlowQuery
+	tracer := newTestSlowQueryTracer(func(_ context.Context, q SlowQuery) {
+		reports = append(reports, q)
+	})
+
+	runSlowQuery(tracer, "SELECT * FROM users WHERE id = 1")
+	runSlowQuery(tracer, "SELECT * FROM users WHERE id = 2")
+	runSlowQuery(tracer, "SELECT * FROM orders WHERE id = 1")
+
+	require.Len(t, reports, 2)
+
+	_, allowed := tracer.allow(reports[0].Fingerprint, time.Now().Add(2*time.Minute))
+	assert.True(t, allowed)
+}
+
+func TestSlowQueryTracer_ReportsSuppressedCount(t *testing.T) {
+	tracer := newTestSlowQueryTracer(nil)
+	now := time.Now()
+
+	_, allowed := tracer.allow("fp", now)
+	require.True(t, allowed)
+	_, allowed = tracer.allow("fp", now.Add(time.Second))
+	require.False(t, allowed)
+	_, allowed = tracer.allow("fp", now.Add(2*time.Second))
+	require.False(t, allowed)
+
+	suppressed, allowed := tracer.allow("fp", now.Add(2*time.Minute))
+	assert.True(t, allowed)
+	assert.Equal(t, 2, suppressed)
+}
+
+func TestSlowQueryTracer_SampleRateZeroReportsNothing(t *testing.T) {
+	var reports []SlowQuery
+	tracer := newTestSlowQueryTracer(func(_ context.Context, q SlowQuery) {
+		reports = append(reports, q)
+	})
+	tracer.opts.sampleRate = 0
+
+	runSlowQuery(tracer, "SELECT 1")
+
+	assert.Empty(t, reports)
+}
+
+func TestSlowQueryTracer_LogsWithoutArgumentValues(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := newTestSlowQueryTracer(nil)
+	tracer.events = newEventLogger(slog.New(slog.NewTextHandler(&buf, nil)), nil)
+
+	runSlowQuery(tracer, "UPDATE users SET password = $1", "hunter2")
+
+	out := buf.String()
+	assert.Contains(t, out, "slow query")
+	assert.Contains(t, out, "args=1")
+	assert.Contains(t, out, "acquire_wait=")
+	assert.NotContains(t, out, "hunter2")
+}
+
+func TestBuildPoolConfigAddsSlowQueryTracer(t *testing.T) {
+	conn, err := NewConnection(baseConfig(), WithSlowQueryThreshold(time.Second))
+	require.NoError(t, err)
+
+	poolConfig, err := conn.buildPoolConfig()
+	require.NoError(t, err)
+
+	_, ok := poolConfig.ConnConfig.Tracer.(*slowQueryTracer)
+	assert.True(t, ok)
+}
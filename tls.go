@@ -0,0 +1,264 @@
+package pgxutils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+
+	errors "github.com/JohnPlummer/jp-go-errors"
+	"github.com/jackc/pgx/v5"
+)
+
+// tlsOptions holds the TLS material applied on top of the sslmode.
+type tlsOptions struct {
+	rootCAFile string
+	rootCAs    *x509.CertPool
+	certFile   string
+	keyFile    string
+	serverName string
+}
+
+// enabled reports whether any TLS option is set.
+func (o tlsOptions) enabled() bool {
+	return o.rootCAFile != "" || o.rootCAs != nil || o.certFile != "" || o.keyFile != "" || o.serverName != ""
+}
+
+// WithRootCAFile verifies the server certificate against the PEM CA bundle in
+// path instead of the system roots. The file is reread when it changes, so new
+// connections trust a rotated CA without a restart.
+//
+// Verification follows the sslmode: verify-ca checks the certificate chain,
+// verify-full also checks the host name. Other modes do not verify the server.
+// Replaces any WithRootCAs.
+func WithRootCAFile(path string) Option {
+	return func(opts *connectionOptions) {
+		opts.tls.rootCAFile = path
+		opts.tls.rootCAs = nil
+	}
+}
+
+// WithRootCAs verifies the server certificate against pool, as WithRootCAFile
+// does with a file. Replaces any WithRootCAFile.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(opts *connectionOptions) {
+		opts.tls.rootCAs = pool
+		opts.tls.rootCAFile = ""
+	}
+}
+
+// WithClientCertificate presents the PEM certificate and key in certFile and
+// keyFile to servers requesting client certificates (mutual TLS). The files
+// are reread when either changes, so renewed certificates are used by new
+// connections without a restart.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(opts *connectionOptions) {
+		opts.tls.certFile = certFile
+		opts.tls.keyFile = keyFile
+	}
+}
+
+// WithServerName sets the name sent for SNI and, with sslmode verify-full,
+// expected in the server certificate, in place of the host connected to.
+// Useful when connecting by IP address or through a proxy.
+func WithServerName(name string) Option {
+	return func(opts *connectionOptions) {
+		opts.tls.serverName = name
+	}
+}
+
+// tlsFiles loads the TLS options, rereading files when they change.
+type tlsFiles struct {
+	opts tlsOptions
+
+	mu        sync.Mutex
+	roots     *x509.CertPool
+	rootStamp fileStamp
+	cert      *tls.Certificate
+	certStamp fileStamp
+	keyStamp  fileStamp
+}
+
+// load returns the current root CAs and client certificate, either of which
+// may be nil when not configured.
+func (f *tlsFiles) load() (*x509.CertPool, *tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.opts.rootCAs != nil {
+		f.roots = f.opts.rootCAs
+	}
+	if f.opts.rootCAFile != "" {
+		if err := f.loadRootCAs(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if f.opts.certFile != "" || f.opts.keyFile != "" {
+		if err := f.loadCertificate(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return f.roots, f.cert, nil
+}
+
+func (f *tlsFiles) loadRootCAs() error {
+	stamp, changed, err := fileChanged(f.opts.rootCAFile, f.rootStamp)
+	if err != nil {
+		return errors.NewValidationError(
+			"failed to read root CA file",
+			"root_ca_file",
+			errors.WithCause(err),
+		)
+	}
+	if !changed {
+		return nil
+	}
+
+	pem, err := os.ReadFile(f.opts.rootCAFile) // #nosec G304 - path is set by the application
+	if err != nil {
+		return errors.NewValidationError(
+			"failed to read root CA file",
+			"root_ca_file",
+			errors.WithCause(err),
+		)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return errors.NewValidationError(
+			fmt.Sprintf("no certificates found in root CA file %s", f.opts.rootCAFile),
+			"root_ca_file",
+		)
+	}
+
+	f.roots, f.rootStamp = roots, stamp
+	return nil
+}
+
+func (f *tlsFiles) loadCertificate() error {
+	if f.opts.certFile == "" || f.opts.keyFile == "" {
+		return errors.NewValidationError(
+			"client certificate requires both a certificate and a key file",
+			"client_certificate",
+		)
+	}
+
+	certStamp, certChanged, err := fileChanged(f.opts.certFile, f.certStamp)
+	if err != nil {
+		return errors.NewValidationError(
+			"failed to read client certificate",
+			"client_certificate",
+			errors.WithCause(err),
+		)
+	}
+	keyStamp, keyChanged, err := fileChanged(f.opts.keyFile, f.keyStamp)
+	if err != nil {
+		return errors.NewValidationError(
+			"failed to read client key",
+			"client_certificate",
+			errors.WithCause(err),
+		)
+	}
+	if !certChanged && !keyChanged {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(f.opts.certFile, f.opts.keyFile)
+	if err != nil {
+		return errors.NewValidationError(
+			"failed to load client certificate",
+			"client_certificate",
+			errors.WithCause(err),
+		)
+	}
+
+	f.cert, f.certStamp, f.keyStamp = &cert, certStamp, keyStamp
+	return nil
+}
+
+// validateTLS rejects TLS options when the sslmode disables TLS, and loads
+// the TLS files so that a misconfiguration fails before any connect attempt.
+func (c *Connection) validateTLS(cc *pgx.ConnConfig) error {
+	usesTLS := cc.TLSConfig != nil
+	for _, fallback := range cc.Fallbacks {
+		usesTLS = usesTLS || fallback.TLSConfig != nil
+	}
+	if !usesTLS {
+		return errors.NewValidationError(
+			"TLS options require an sslmode other than disable",
+			"ssl_mode",
+		)
+	}
+
+	_, _, err := c.tls.load()
+	return err
+}
+
+// applyTLS sets the current TLS material on every TLS config of a new
+// connection, including those of fallback hosts.
+func (c *Connection) applyTLS(cc *pgx.ConnConfig) error {
+	roots, cert, err := c.tls.load()
+	if err != nil {
+		return err
+	}
+
+	cc.TLSConfig = configureTLS(cc.TLSConfig, roots, cert, c.opts.tls.serverName)
+	for _, fallback := range cc.Fallbacks {
+		fallback.TLSConfig = configureTLS(fallback.TLSConfig, roots, cert, c.opts.tls.serverName)
+	}
+	return nil
+}
+
+// configureTLS returns a copy of base, the config pgx derived from the
+// sslmode, with the given material applied. A nil base means no TLS.
+func configureTLS(base *tls.Config, roots *x509.CertPool, cert *tls.Certificate, serverName string) *tls.Config {
+	if base == nil {
+		return nil
+	}
+
+	cfg := base.Clone()
+	if serverName != "" {
+		cfg.ServerName = serverName
+	}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	if roots != nil {
+		cfg.RootCAs = roots
+		// pgx implements verify-ca with a callback bound to its own roots
+		if base.VerifyPeerCertificate != nil {
+			cfg.VerifyPeerCertificate = verifyChain(roots)
+		}
+	}
+	return cfg
+}
+
+// verifyChain verifies the server's certificate chain against roots without
+// checking the host name, as libpq's sslmode=verify-ca does.
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server presented no certificate")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse server certificate: %w", err)
+			}
+			certs[i] = cert
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
@@ -0,0 +1,275 @@
+package pgxutils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a generated certificate with its key.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCA generates a self-signed CA certificate.
+func newTestCA(t *testing.T, name string) *testCert {
+	t.Helper()
+	return issueTestCert(t, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	})
+}
+
+// issue generates a certificate signed by ca, valid for hosts as a server
+// and for the common name as a client.
+func (ca *testCert) issue(t *testing.T, commonName string, hosts ...string) *testCert {
+	t.Helper()
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	return issueTestCert(t, ca, template)
+}
+
+func issueTestCert(t *testing.T, parent *testCert, template *x509.Certificate) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+// write stores the certificate and key as PEM files in dir.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(c.key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// touchLater moves a file's modification time forward so a rewrite within the
+// same clock tick is still seen as a change.
+func touchLater(t *testing.T, paths ...string) {
+	t.Helper()
+	later := time.Now().Add(time.Minute)
+	for _, path := range paths {
+		require.NoError(t, os.Chtimes(path, later, later))
+	}
+}
+
+func tlsTestConnection(t *testing.T, sslMode string, opts ...Option) (*Connection, *pgx.ConnConfig) {
+	t.Helper()
+
+	cfg := baseConfig()
+	cfg.SSLMode = sslMode
+	conn, err := NewConnection(cfg, opts...)
+	require.NoError(t, err)
+
+	poolConfig, err := conn.buildPoolConfig()
+	require.NoError(t, err)
+	require.NotNil(t, poolConfig.BeforeConnect)
+
+	cc := poolConfig.ConnConfig.Copy()
+	require.NoError(t, poolConfig.BeforeConnect(context.Background(), cc))
+	return conn, cc
+}
+
+func TestTLS_RootCAFileVerifyFull(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	_, cc := tlsTestConnection(t, "verify-full", WithRootCAFile(caFile), WithServerName("db.internal"))
+
+	require.NotNil(t, cc.TLSConfig)
+	assert.False(t, cc.TLSConfig.InsecureSkipVerify)
+	assert.Equal(t, "db.internal", cc.TLSConfig.ServerName)
+
+	_, err := ca.issue(t, "db", "db.internal").cert.Verify(x509.VerifyOptions{
+		Roots:   cc.TLSConfig.RootCAs,
+		DNSName: cc.TLSConfig.ServerName,
+	})
+	assert.NoError(t, err)
+}
+
+func TestTLS_RootCAsVerifyCA(t *testing.T) {
+	ca := newTestCA(t, "test-ca")
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	_, cc := tlsTestConnection(t, "verify-ca", WithRootCAs(roots))
+	require.NotNil(t, cc.TLSConfig.VerifyPeerCertificate)
+
+	// The host name is not checked, only the chain
+	server := ca.issue(t, "db", "some-other-name")
+	assert.NoError(t, cc.TLSConfig.VerifyPeerCertificate([][]byte{server.cert.Raw}, nil))
+
+	untrusted := newTestCA(t, "other-ca").issue(t, "db", "localhost")
+	assert.Error(t, cc.TLSConfig.VerifyPeerCertificate([][]byte{untrusted.cert.Raw}, nil))
+}
+
+func TestTLS_AppliesToFallbacks(t *testing.T) {
+	ca := newTestCA(t, "test-ca")
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// prefer tries TLS first, then falls back to plain text
+	_, cc := tlsTestConnection(t, "prefer", WithRootCAs(roots))
+	assert.Same(t, roots, cc.TLSConfig.RootCAs)
+	require.NotEmpty(t, cc.Fallbacks)
+	for _, fallback := range cc.Fallbacks {
+		if fallback.TLSConfig != nil {
+			assert.Same(t, roots, fallback.TLSConfig.RootCAs)
+		}
+	}
+}
+
+func TestTLS_ClientCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	certFile, keyFile := ca.issue(t, "first").write(t, dir, "client")
+
+	conn, cc := tlsTestConnection(t, "require", WithClientCertificate(certFile, keyFile))
+	require.Len(t, cc.TLSConfig.Certificates, 1)
+	assert.Equal(t, "first", commonName(t, cc.TLSConfig.Certificates[0]))
+
+	// A renewed certificate is used by the next connection
+	ca.issue(t, "second").write(t, dir, "client")
+	touchLater(t, certFile, keyFile)
+
+	cc = &pgx.ConnConfig{}
+	cc.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	require.NoError(t, conn.beforeConnect(context.Background(), cc))
+	assert.Equal(t, "second", commonName(t, cc.TLSConfig.Certificates[0]))
+}
+
+func commonName(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestTLS_MutualHandshake(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := ca.issue(t, "app").write(t, dir, "client")
+	serverCert := ca.issue(t, "db", "db.internal")
+
+	_, cc := tlsTestConnection(t, "verify-full",
+		WithRootCAFile(caFile),
+		WithClientCertificate(certFile, keyFile),
+		WithServerName("db.internal"),
+	)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	serverConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.cert.Raw}, PrivateKey: serverCert.key}},
+		ClientCAs:    roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		server := tls.Server(serverConn, serverConfig)
+		err := server.Handshake()
+		if err == nil && len(server.ConnectionState().PeerCertificates) == 0 {
+			err = assert.AnError
+		}
+		serverDone <- err
+	}()
+
+	require.NoError(t, tls.Client(clientConn, cc.TLSConfig).Handshake())
+	require.NoError(t, <-serverDone)
+}
+
+func TestTLS_Validation(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, _ := ca.issue(t, "app").write(t, dir, "client")
+
+	notPEM := filepath.Join(dir, "not-pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+
+	tests := []struct {
+		name    string
+		sslMode string
+		opts    []Option
+		wantErr string
+	}{
+		{"TLS disabled", "disable", []Option{WithRootCAFile(caFile)}, "TLS options require"},
+		{"missing CA file", "verify-full", []Option{WithRootCAFile(filepath.Join(dir, "missing"))}, "failed to read root CA file"},
+		{"CA file without certificates", "verify-full", []Option{WithRootCAFile(notPEM)}, "no certificates found"},
+		{"certificate without key", "require", []Option{WithClientCertificate(certFile, "")}, "both a certificate and a key"},
+		{"mismatched key", "require", []Option{WithClientCertificate(certFile, caFile)}, "failed to load client certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := baseConfig()
+			cfg.SSLMode = tt.sslMode
+			conn, err := NewConnection(cfg, tt.opts...)
+			require.NoError(t, err)
+
+			_, err = conn.buildPoolConfig()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package pgxutils
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WithTracer adds a pgx tracer to every connection in the pool.
+//
+// May be given more than once; tracers run in the order they were added.
+// Tracers that also implement pgx.BatchTracer, pgx.CopyFromTracer,
+// pgx.PrepareTracer, pgx.ConnectTracer, pgxpool.AcquireTracer or
+// pgxpool.ReleaseTracer receive those events too. A RedactingTracer is
+// replaced by its copy that redacts the Connection's passwords.
+func WithTracer(tracer pgx.QueryTracer) Option {
+	return func(opts *connectionOptions) {
+		if tracer != nil {
+			opts.tracers = append(opts.tracers, tracer)
+		}
+	}
+}
+
+// RedactingTracer is a tracer that records SQL or error text and can remove
+// passwords from it, such as SlogTracer and pgxotel.Tracer.
+type RedactingTracer interface {
+	pgx.QueryTracer
+	// WithRedaction returns a copy of the tracer that passes every statement
+	// and error message it records through redact.
+	WithRedaction(redact func(string) string) pgx.QueryTracer
+}
+
+// combineTracers returns nil, the only tracer, or a multiTracer fanning out to all of them.
+func combineTracers(tracers []pgx.QueryTracer) pgx.QueryTracer {
+	switch len(tracers) {
+	case 0:
+		return nil
+	case 1:
+		return tracers[0]
+	default:
+		return multiTracer(append([]pgx.QueryTracer(nil), tracers...))
+	}
+}
+
+// multiTracer forwards each pgx trace event to every tracer that supports it.
+//
+// Start hooks run in order, each receiving the context returned by the previous
+// one. Each tracer's later hooks for the operation receive the context its own
+// start hook returned, so a tracer that keeps a span in the context ends its
+// own span rather than the one the last tracer started.
+type multiTracer []pgx.QueryTracer
+
+// multiTraceKey stores, for one kind of traced operation, the context each
+// tracer returned from its start hook.
+type multiTraceKey int
+
+const (
+	multiTraceQuery multiTraceKey = iota
+	multiTraceBatch
+	multiTraceCopyFrom
+	multiTracePrepare
+	multiTraceConnect
+	multiTraceAcquire
+)
+
+// start runs the start hook of every tracer, through fn, which reports false
+// for tracers that do not trace the operation.
+func (m multiTracer) start(ctx context.Context, key multiTraceKey, fn func(pgx.QueryTracer, context.Context) (context.Context, bool)) context.Context {
+	ctxs := make([]context.Context, len(m))
+	for i, t := range m {
+		if next, ok := fn(t, ctx); ok {
+			ctx = next
+			ctxs[i] = next
+		}
+	}
+	return context.WithValue(ctx, key, ctxs)
+}
+
+// each calls fn for every tracer with the context its start hook returned, or
+// ctx when it has none.
+func (m multiTracer) each(ctx context.Context, key multiTraceKey, fn func(pgx.QueryTracer, context.Context)) {
+	ctxs, _ := ctx.Value(key).([]context.Context)
+	for i, t := range m {
+		tctx := ctx
+		if i < len(ctxs) && ctxs[i] != nil {
+			tctx = ctxs[i]
+		}
+		fn(t, tctx)
+	}
+}
+
+func (m multiTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return m.start(ctx, multiTraceQuery, func(t pgx.QueryTracer, ctx context.Context) (context.Context, bool) {
+		return t.TraceQueryStart(ctx, conn, data), true
+	})
+}
+
+func (m multiTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	m.each(ctx, multiTraceQuery, func(t pgx.QueryTracer, ctx context.Context) {
+		t.TraceQueryEnd(ctx, conn, data)
+	})
+}
+
+func (m multiTracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	return m.start(ctx, multiTraceBatch, func(t pgx.QueryTracer, ctx context.Context) (context.Context, bool) {
+		if bt, ok := t.(pgx.BatchTracer); ok {
+			return bt.TraceBatchStart(ctx, conn, data), true
+		}
+		return ctx, false
+	})
+}
+
+func (m multiTracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	m.each(ctx, multiTraceBatch, func(t pgx.QueryTracer, ctx context.Context) {
+		if bt, ok := t.(pgx.BatchTracer); ok {
+			bt.TraceBatchQuery(ctx, conn, data)
+		}
+	})
+}
+
+func (m multiTracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	m.each(ctx, multiTraceBatch, func(t pgx.QueryTracer, ctx context.Context) {
+		if bt, ok := t.(pgx.BatchTracer); ok {
+			bt.TraceBatchEnd(ctx, conn, data)
+		}
+	})
+}
+
+func (m multiTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return m.start(ctx, multiTraceCopyFrom, func(t pgx.QueryTracer, ctx context.Context) (context.Context, bool) {
+		if ct, ok := t.(pgx.CopyFromTracer); ok {
+			return ct.TraceCopyFromStart(ctx, conn, data), true
+		}
+		return ctx, false
+	})
+}
+
+func (m multiTracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	m.each(ctx, multiTraceCopyFrom, func(t pgx.QueryTracer, ctx context.Context) {
+		if ct, ok := t.(pgx.CopyFromTracer); ok {
+			ct.TraceCopyFromEnd(ctx, conn, data)
+		}
+	})
+}
+
+func (m multiTracer) TracePrepareStart(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareStartData) context.Context {
+	return m.start(ctx, multiTracePrepare, func(t pgx.QueryTracer, ctx context.Context) (context.Context, bool) {
+		if pt, ok := t.(pgx.PrepareTracer); ok {
+			return pt.TracePrepareStart(ctx, conn, data), true
+		}
+		return ctx, false
+	})
+}
+
+func (m multiTracer) TracePrepareEnd(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareEndData) {
+	m.each(ctx, multiTracePrepare, func(t pgx.QueryTracer, ctx context.Context) {
+		if pt, ok := t.(pgx.PrepareTracer); ok {
+			pt.TracePrepareEnd(ctx, conn, data)
+		}
+	})
+}
+
+func (m multiTracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	return m.start(ctx, multiTraceConnect, func(t pgx.QueryTracer, ctx context.Context) (context.Context, bool) {
+		if ct, ok := t.(pgx.ConnectTracer); ok {
+			return ct.TraceConnectStart(ctx, data), true
+		}
+		return ctx, false
+	})
+}
+
+func (m multiTracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	m.each(ctx, multiTraceConnect, func(t pgx.QueryTracer, ctx context.Context) {
+		if ct, ok := t.(pgx.ConnectTracer); ok {
+			ct.TraceConnectEnd(ctx, data)
+		}
+	})
+}
+
+func (m multiTracer) TraceAcquireStart(ctx context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireStartData) context.Context {
+	return m.start(ctx, multiTraceAcquire, func(t pgx.QueryTracer, ctx context.Context) (context.Context, bool) {
+		if at, ok := t.(pgxpool.AcquireTracer); ok {
+			return at.TraceAcquireStart(ctx, pool, data), true
+		}
+		return ctx, false
+	})
+}
+
+func (m multiTracer) TraceAcquireEnd(ctx context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	m.each(ctx, multiTraceAcquire, func(t pgx.QueryTracer, ctx context.Context) {
+		if at, ok := t.(pgxpool.AcquireTracer); ok {
+			at.TraceAcquireEnd(ctx, pool, data)
+		}
+	})
+}
+
+func (m multiTracer) TraceRelease(pool *pgxpool.Pool, data pgxpool.TraceReleaseData) {
+	for _, t := range m {
+		if rt, ok := t.(pgxpool.ReleaseTracer); ok {
+			rt.TraceRelease(pool, data)
+		}
+	}
+}
+
+// QueryOperation returns the leading SQL keyword of a statement in upper case,
+// such as SELECT, INSERT or WITH. Leading whitespace and comments are skipped.
+// Returns an empty string if the statement has no keyword.
+func QueryOperation(sql string) string {
+	s := skipSQLComments(sql)
+
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if end < 0 {
+		end = len(s)
+	}
+
+	return strings.ToUpper(s[:end])
+}
+
+// skipSQLComments strips leading whitespace, "--" comments and "/* */" comments.
+func skipSQLComments(sql string) string {
+	s := sql
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		switch {
+		case strings.HasPrefix(s, "--"):
+			nl := strings.IndexByte(s, '\n')
+			if nl < 0 {
+				return ""
+			}
+			s = s[nl+1:]
+		case strings.HasPrefix(s, "/*"):
+			end := strings.Index(s, "*/")
+			if end < 0 {
+				return ""
+			}
+			s = s[end+2:]
+		default:
+			return s
+		}
+	}
+}
+
+// SQLState returns the SQLSTATE code of a PostgreSQL error, or an empty string
+// if err does not wrap a *pgconn.PgError.
+func SQLState(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+const (
+	// LogEventQuery is logged by SlogTracer for each successful statement.
+	LogEventQuery LogEvent = "query"
+	// LogEventQueryFailed is logged by SlogTracer for each failed statement.
+	LogEventQueryFailed LogEvent = "query_failed"
+)
+
+// SlogTracer logs every statement with its duration, rows affected and, on
+// failure, the SQLSTATE code.
+//
+// Successful statements log at DEBUG and failures at WARN; use a LogLevelPolicy
+// to change either. Covers Exec/Query/QueryRow, SendBatch and CopyFrom.
+type SlogTracer struct {
+	events eventLogger
+	redact func(string) string
+}
+
+var (
+	_ pgx.QueryTracer    = (*SlogTracer)(nil)
+	_ pgx.BatchTracer    = (*SlogTracer)(nil)
+	_ pgx.CopyFromTracer = (*SlogTracer)(nil)
+	_ RedactingTracer    = (*SlogTracer)(nil)
+)
+
+// NewSlogTracer creates a SlogTracer. A nil logger falls back to slog.Default()
+// and a nil policy keeps the default levels.
+//
+// Example usage:
+//
+//	conn, err := pgxutils.NewConnection(cfg,
+//	    pgxutils.WithTracer(pgxutils.NewSlogTracer(logger, nil)),
+//	)
+func NewSlogTracer(logger *slog.Logger, levels LogLevelPolicy) *SlogTracer {
+	return &SlogTracer{events: newEventLogger(logger, levels)}
+}
+
+// WithRedaction implements RedactingTracer.
+func (t *SlogTracer) WithRedaction(redact func(string) string) pgx.QueryTracer {
+	return &SlogTracer{events: t.events, redact: redact}
+}
+
+// redacted passes sql and err through the redaction, if any.
+func (t *SlogTracer) redacted(sql string, err error) (string, error) {
+	if t.redact == nil {
+		return sql, err
+	}
+	return t.redact(sql), redactErrorWith(err, t.redact)
+}
+
+// slogTraceKey stores the start of a traced operation in the context.
+type slogTraceKey struct{}
+
+// slogBatchSizeKey stores the number of queued statements of a traced batch.
+type slogBatchSizeKey struct{}
+
+type slogTraceStart struct {
+	sql   string
+	start time.Time
+}
+
+func (t *SlogTracer) begin(ctx context.Context, sql string) context.Context {
+	return context.WithValue(ctx, slogTraceKey{}, slogTraceStart{sql: sql, start: time.Now()})
+}
+
+func (t *SlogTracer) end(ctx context.Context, tag pgconn.CommandTag, err error, args ...any) {
+	started, ok := ctx.Value(slogTraceKey{}).(slogTraceStart)
+	if !ok {
+		return
+	}
+	sql, err := t.redacted(started.sql, err)
+
+	attrs := append([]any{
+		"sql", sql,
+		"duration", time.Since(started.start),
+		"rows_affected", tag.RowsAffected(),
+	}, args...)
+
+	if err != nil {
+		attrs = append(attrs, "error", err)
+		if code := SQLState(err); code != "" {
+			attrs = append(attrs, "sqlstate", code)
+		}
+		t.events.log(ctx, LogEventQueryFailed, slog.LevelWarn, "query failed", attrs...)
+		return
+	}
+
+	t.events.log(ctx, LogEventQuery, slog.LevelDebug, "query executed", attrs...)
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *SlogTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return t.begin(ctx, data.SQL)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *SlogTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.end(ctx, data.CommandTag, data.Err)
+}
+
+// TraceBatchStart implements pgx.BatchTracer.
+func (t *SlogTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	size := 0
+	if data.Batch != nil {
+		size = data.Batch.Len()
+	}
+	ctx = t.begin(ctx, "batch")
+	return context.WithValue(ctx, slogBatchSizeKey{}, size)
+}
+
+// TraceBatchQuery implements pgx.BatchTracer. Individual batch statements are
+// logged with the rows they affected but without a duration of their own.
+func (t *SlogTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	sql, err := t.redacted(data.SQL, data.Err)
+	attrs := []any{"sql", sql, "rows_affected", data.CommandTag.RowsAffected()}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+		if code := SQLState(err); code != "" {
+			attrs = append(attrs, "sqlstate", code)
+		}
+		t.events.log(ctx, LogEventQueryFailed, slog.LevelWarn, "batch query failed", attrs...)
+		return
+	}
+	t.events.log(ctx, LogEventQuery, slog.LevelDebug, "batch query executed", attrs...)
+}
+
+// TraceBatchEnd implements pgx.BatchTracer.
+func (t *SlogTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	size, _ := ctx.Value(slogBatchSizeKey{}).(int)
+	t.end(ctx, pgconn.CommandTag{}, data.Err, "batch_size", size)
+}
+
+// TraceCopyFromStart implements pgx.CopyFromTracer.
+func (t *SlogTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return t.begin(ctx, "COPY "+data.TableName.Sanitize())
+}
+
+// TraceCopyFromEnd implements pgx.CopyFromTracer.
+func (t *SlogTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.end(ctx, data.CommandTag, data.Err)
+}
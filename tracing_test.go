@@ -0,0 +1,181 @@
+package pgxutils
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryOperation(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{sql: "SELECT 1", want: "SELECT"},
+		{sql: "  insert into users (name) values ($1)", want: "INSERT"},
+		{sql: "-- fetch users\nselect * from users", want: "SELECT"},
+		{sql: "/* app=api */ UPDATE users SET name = $1", want: "UPDATE"},
+		{sql: "WITH t AS (SELECT 1) SELECT * FROM t", want: "WITH"},
+		{sql: "", want: ""},
+		{sql: "-- only a comment", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			assert.Equal(t, tt.want, QueryOperation(tt.sql))
+		})
+	}
+}
+
+func TestSQLState(t *testing.T) {
+	assert.Equal(t, "23505", SQLState(&pgconn.PgError{Code: "23505"}))
+	assert.Empty(t, SQLState(assert.AnError))
+	assert.Empty(t, SQLState(nil))
+}
+
+// recordingTracer records the order its hooks ran in. Like a span-creating
+// tracer, it keeps its state under a key every instance shares.
+type recordingTracer struct {
+	name  string
+	calls *[]string
+}
+
+type recordingKey struct{}
+
+func (r recordingTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	*r.calls = append(*r.calls, r.name+":start")
+	return context.WithValue(ctx, recordingKey{}, r.name)
+}
+
+func (r recordingTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	started, _ := ctx.Value(recordingKey{}).(string)
+	*r.calls = append(*r.calls, r.name+":end:"+started)
+}
+
+func (r recordingTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return context.WithValue(ctx, recordingKey{}, r.name)
+}
+
+func (r recordingTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchQueryData) {
+	started, _ := ctx.Value(recordingKey{}).(string)
+	*r.calls = append(*r.calls, r.name+":batch-query:"+started)
+}
+
+func (r recordingTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchEndData) {
+	started, _ := ctx.Value(recordingKey{}).(string)
+	*r.calls = append(*r.calls, r.name+":batch-end:"+started)
+}
+
+func TestCombineTracers(t *testing.T) {
+	assert.Nil(t, combineTracers(nil))
+
+	single := NewSlogTracer(nil, nil)
+	assert.Same(t, single, combineTracers([]pgx.QueryTracer{single}))
+
+	var calls []string
+	tracer := combineTracers([]pgx.QueryTracer{
+		recordingTracer{name: "a", calls: &calls},
+		recordingTracer{name: "b", calls: &calls},
+	})
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	// Each tracer ends what it started, not what the last tracer started
+	assert.Equal(t, []string{"a:start", "b:start", "a:end:a", "b:end:b"}, calls)
+}
+
+func TestCombineTracers_BatchHooksGetOwnContext(t *testing.T) {
+	var calls []string
+	tracer := combineTracers([]pgx.QueryTracer{
+		recordingTracer{name: "a", calls: &calls},
+		NewSlogTracer(nil, nil),
+		recordingTracer{name: "b", calls: &calls},
+	}).(pgx.BatchTracer)
+
+	ctx := tracer.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{})
+	tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 1"})
+	tracer.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{})
+
+	assert.Equal(t, []string{
+		"a:batch-query:a", "b:batch-query:b",
+		"a:batch-end:a", "b:batch-end:b",
+	}, calls)
+}
+
+func TestBuildPoolConfigSetsTracer(t *testing.T) {
+	var calls []string
+	tracer := recordingTracer{name: "a", calls: &calls}
+
+	conn, err := NewConnection(baseConfig(), WithTracer(tracer))
+	require.NoError(t, err)
+
+	poolConfig, err := conn.buildPoolConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, tracer, poolConfig.ConnConfig.Tracer)
+}
+
+func TestBuildPoolConfigRedactsSlogTracer(t *testing.T) {
+	var buf bytes.Buffer
+	shared := NewSlogTracer(slog.New(slog.NewTextHandler(&buf, nil)), nil)
+
+	cfg := baseConfig()
+	cfg.Password = "correct-horse"
+	conn, err := NewConnection(cfg, WithTracer(shared))
+	require.NoError(t, err)
+
+	poolConfig, err := conn.buildPoolConfig()
+	require.NoError(t, err)
+
+	tracer, ok := poolConfig.ConnConfig.Tracer.(*SlogTracer)
+	require.True(t, ok)
+	assert.NotSame(t, shared, tracer, "the shared tracer is not modified")
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL: "ALTER ROLE app PASSWORD 'correct-horse'",
+	})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{
+		Err: &pgconn.PgError{Code: "42501", Message: "cannot set password correct-horse"},
+	})
+
+	out := buf.String()
+	assert.NotContains(t, out, "correct-horse")
+	assert.Contains(t, out, "ALTER ROLE app PASSWORD 'xxxxx'")
+	assert.Contains(t, out, "sqlstate=42501")
+}
+
+func TestSlogTracer_LogsQuery(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	tracer := NewSlogTracer(logger, nil)
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "UPDATE users SET name = $1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("UPDATE 3")})
+
+	out := buf.String()
+	assert.Contains(t, out, "DEBUG")
+	assert.Contains(t, out, "query executed")
+	assert.Contains(t, out, "rows_affected=3")
+	assert.Contains(t, out, "duration=")
+}
+
+func TestSlogTracer_LogsFailureWithSQLState(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	tracer := NewSlogTracer(logger, nil)
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "INSERT INTO users (id) VALUES (1)"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: &pgconn.PgError{Code: "23505", Message: "duplicate key"}})
+
+	out := buf.String()
+	assert.Contains(t, out, "WARN")
+	assert.Contains(t, out, "query failed")
+	assert.Contains(t, out, "sqlstate=23505")
+}
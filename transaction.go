@@ -2,8 +2,10 @@ package pgxutils
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	errors "github.com/JohnPlummer/jp-go-errors"
 	"github.com/jackc/pgx/v5"
@@ -37,6 +39,12 @@ type TransactionRollback interface {
 //	    }
 //	}()
 func HandleTransactionRollback(ctx context.Context, tx TransactionRollback, logger *slog.Logger) {
+	handleTransactionRollback(ctx, tx, newEventLogger(logger, nil))
+}
+
+// handleTransactionRollback implements HandleTransactionRollback with the
+// caller's log level policy applied.
+func handleTransactionRollback(ctx context.Context, tx TransactionRollback, events eventLogger) {
 	if tx == nil {
 		return
 	}
@@ -50,13 +58,19 @@ func HandleTransactionRollback(ctx context.Context, tx TransactionRollback, logg
 		if strings.Contains(errMsg, "tx is closed") ||
 			errors.Is(rbErr, context.Canceled) ||
 			strings.Contains(errMsg, "conn busy") {
-			logger.Warn(
+			events.log(
+				ctx,
+				LogEventRollbackSkipped,
+				slog.LevelWarn,
 				"transaction rollback skipped (expected condition)",
 				"error", rbErr,
 			)
 		} else {
 			// Unexpected rollback failure: log as error
-			logger.Error(
+			events.log(
+				ctx,
+				LogEventRollbackFailed,
+				slog.LevelError,
 				"failed to rollback transaction",
 				"error", rbErr,
 			)
@@ -118,6 +132,12 @@ func RollbackTransaction(ctx context.Context, tx TransactionRollback, logger *sl
 // If the function returns an error, the transaction is rolled back.
 // Otherwise, the transaction is committed.
 //
+// A nil logger falls back to the Connection's logger. Either way the
+// Connection's log level policy applies to rollback logging.
+//
+// If ctx carries a transaction (see WithTransactionContext), a SAVEPOINT is
+// opened on it instead of a new transaction.
+//
 // This helper simplifies transaction management by handling the
 // Begin/Commit/Rollback boilerplate.
 //
@@ -132,7 +152,33 @@ func RollbackTransaction(ctx context.Context, tx TransactionRollback, logger *sl
 //	    return err
 //	})
 func WithTransaction(ctx context.Context, conn *Connection, logger *slog.Logger, fn func(pgx.Tx) error) error {
-	tx, err := conn.Begin(ctx)
+	return WithTransactionOptions(ctx, conn, logger, pgx.TxOptions{}, fn)
+}
+
+// WithTransactionOptions is WithTransaction with explicit transaction options,
+// giving access to isolation level, access mode and deferrable mode with the
+// same commit, rollback and panic handling.
+//
+// Example usage:
+//
+//	err := pgxutils.WithTransactionOptions(ctx, conn, logger, pgx.TxOptions{
+//	    IsoLevel:   pgx.RepeatableRead,
+//	    AccessMode: pgx.ReadOnly,
+//	}, func(tx pgx.Tx) error {
+//	    return tx.QueryRow(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+//	})
+func WithTransactionOptions(ctx context.Context, conn *Connection, logger *slog.Logger, txOptions pgx.TxOptions, fn func(pgx.Tx) error) error {
+	return runTransaction(ctx, conn, logger, txOptions, func(_ context.Context, tx pgx.Tx) error {
+		return fn(tx)
+	})
+}
+
+// runTransaction implements the package-level transaction helpers.
+//
+// When ctx already carries a transaction it opens a SAVEPOINT on it instead,
+// and txOptions are ignored. fn receives ctx extended with the new transaction.
+func runTransaction(ctx context.Context, conn *Connection, logger *slog.Logger, txOptions pgx.TxOptions, fn func(context.Context, pgx.Tx) error) error {
+	tx, err := conn.beginContextTx(ctx, txOptions)
 	if err != nil {
 		return errors.NewProcessingError(
 			"failed to begin transaction",
@@ -141,14 +187,24 @@ func WithTransaction(ctx context.Context, conn *Connection, logger *slog.Logger,
 		)
 	}
 
+	events := conn.events()
+	if logger != nil {
+		events.logger = logger
+	}
+
 	var fnErr error
 	defer func() {
+		if p := recover(); p != nil {
+			// Rollback on panic
+			handleTransactionRollback(ctx, tx, events)
+			panic(p)
+		}
 		if fnErr != nil {
-			HandleTransactionRollback(ctx, tx, logger)
+			handleTransactionRollback(ctx, tx, events)
 		}
 	}()
 
-	fnErr = fn(tx)
+	fnErr = fn(ContextWithTx(ctx, tx), tx)
 	if fnErr != nil {
 		return fnErr
 	}
@@ -157,9 +213,172 @@ func WithTransaction(ctx context.Context, conn *Connection, logger *slog.Logger,
 		return errors.NewProcessingError(
 			"failed to commit transaction",
 			"with_transaction",
-			errors.WithCause(err),
+			errors.WithCause(conn.classify(err)),
 		)
 	}
 
 	return nil
 }
+
+// LogEventTransactionRetry is logged before a transaction is re-run after a
+// serialization failure or deadlock.
+const LogEventTransactionRetry LogEvent = "transaction_retry"
+
+// SQLSTATE codes that mean the transaction can safely be re-run from the start.
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// TxRetryOption is a functional option for configuring WithRetryableTransaction.
+type TxRetryOption func(*txRetryOptions)
+
+// txRetryOptions holds optional configuration for WithRetryableTransaction.
+type txRetryOptions struct {
+	maxAttempts int
+	backoff     backoff
+	onRetry     func(attempt int, err error, delay time.Duration)
+	txOptions   pgx.TxOptions
+}
+
+// newTxRetryOptions applies opts over the defaults.
+func newTxRetryOptions(opts []TxRetryOption) txRetryOptions {
+	o := txRetryOptions{
+		maxAttempts: 5,
+		backoff: backoff{
+			initial:    10 * time.Millisecond,
+			max:        time.Second,
+			multiplier: 2,
+		},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// WithTxMaxAttempts sets how many times the transaction runs in total.
+// Default is 5.
+func WithTxMaxAttempts(attempts int) TxRetryOption {
+	return func(opts *txRetryOptions) {
+		opts.maxAttempts = attempts
+	}
+}
+
+// WithTxBackoff sets the initial and maximum delay between attempts. The delay
+// doubles each attempt and is fully jittered. Default is 10ms up to 1s.
+func WithTxBackoff(initial, maxDelay time.Duration) TxRetryOption {
+	return func(opts *txRetryOptions) {
+		opts.backoff.initial = initial
+		opts.backoff.max = maxDelay
+	}
+}
+
+// WithTxRetryHook sets a function called before each retry with the attempt
+// that failed, its error and the delay before the next attempt.
+func WithTxRetryHook(hook func(attempt int, err error, delay time.Duration)) TxRetryOption {
+	return func(opts *txRetryOptions) {
+		opts.onRetry = hook
+	}
+}
+
+// WithTxOptions sets the isolation level, access mode and deferrable mode of
+// each attempt. Default is the server's defaults.
+func WithTxOptions(txOptions pgx.TxOptions) TxRetryOption {
+	return func(opts *txRetryOptions) {
+		opts.txOptions = txOptions
+	}
+}
+
+// IsSerializationFailure reports whether err is a serialization failure (40001)
+// or deadlock (40P01), after which the whole transaction can be re-run.
+func IsSerializationFailure(err error) bool {
+	switch SQLState(err) {
+	case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+		return true
+	default:
+		return false
+	}
+}
+
+// WithRetryableTransaction runs fn in a transaction like WithTransaction, and
+// re-runs the whole transaction when it fails with a serialization failure or
+// deadlock. Intended for SERIALIZABLE and REPEATABLE READ workloads.
+//
+// fn may run several times, so it must not have side effects outside the
+// transaction. Retries wait with jittered exponential backoff, stop when ctx is
+// done, and never happen once a commit has succeeded. When ctx already carries
+// a transaction fn runs once in a savepoint, since a serialization failure
+// aborts the outer transaction and only its owner can re-run it.
+//
+// Example usage:
+//
+//	err := pgxutils.WithRetryableTransaction(ctx, conn, logger, func(tx pgx.Tx) error {
+//	    _, err := tx.Exec(ctx, "UPDATE accounts SET balance = balance - $1 WHERE id = $2", 10, 1)
+//	    return err
+//	}, pgxutils.WithTxMaxAttempts(3), pgxutils.WithTxOptions(pgx.TxOptions{IsoLevel: pgx.Serializable}))
+func WithRetryableTransaction(ctx context.Context, conn *Connection, logger *slog.Logger, fn func(pgx.Tx) error, opts ...TxRetryOption) error {
+	events := conn.events()
+	if logger != nil {
+		events.logger = logger
+	}
+
+	o := newTxRetryOptions(opts)
+	if _, nested := TxFromContext(ctx); nested {
+		return WithTransactionOptions(ctx, conn, logger, o.txOptions, fn)
+	}
+
+	return retryTransaction(ctx, events, o, func() error {
+		return WithTransactionOptions(ctx, conn, logger, o.txOptions, fn)
+	})
+}
+
+// WithRetryableTransaction runs fn in a transaction, re-running it on
+// serialization failures and deadlocks. See the package-level
+// WithRetryableTransaction for details.
+func (db *Connection) WithRetryableTransaction(ctx context.Context, fn func(pgx.Tx) error, opts ...TxRetryOption) error {
+	return WithRetryableTransaction(ctx, db, nil, fn, opts...)
+}
+
+// retryTransaction calls run until it succeeds, fails with a non-retryable
+// error, exhausts its attempts, or ctx is done.
+func retryTransaction(ctx context.Context, events eventLogger, o txRetryOptions, run func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || !IsSerializationFailure(err) {
+			return err
+		}
+
+		if attempt >= o.maxAttempts {
+			return errors.NewProcessingError(
+				fmt.Sprintf("transaction failed after %d attempts", attempt),
+				"with_retryable_transaction",
+				errors.WithCause(err),
+			)
+		}
+
+		delay := o.backoff.delay(attempt)
+		if o.onRetry != nil {
+			o.onRetry(attempt, err, delay)
+		}
+		events.log(
+			ctx,
+			LogEventTransactionRetry,
+			slog.LevelInfo,
+			"retrying transaction",
+			"attempt", attempt,
+			"delay", delay,
+			"sqlstate", SQLState(err),
+		)
+
+		if waitErr := sleepContext(ctx, delay); waitErr != nil {
+			return errors.NewProcessingError(
+				"transaction retry interrupted by context",
+				"with_retryable_transaction",
+				errors.WithCause(waitErr),
+			)
+		}
+	}
+}
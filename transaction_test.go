@@ -6,7 +6,9 @@ import (
 	"errors"
 	"log/slog"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -149,3 +151,84 @@ func TestRollbackTransaction_ContextDeadlineExceeded(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "context deadline")
 }
+
+func TestIsSerializationFailure(t *testing.T) {
+	assert.True(t, IsSerializationFailure(&pgconn.PgError{Code: "40001"}))
+	assert.True(t, IsSerializationFailure(&pgconn.PgError{Code: "40P01"}))
+	assert.False(t, IsSerializationFailure(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, IsSerializationFailure(errors.New("boom")))
+	assert.False(t, IsSerializationFailure(nil))
+}
+
+func TestRetryTransaction_RetriesSerializationFailures(t *testing.T) {
+	calls := 0
+	var retries []int
+
+	o := newTxRetryOptions([]TxRetryOption{
+		WithTxBackoff(time.Millisecond, time.Millisecond),
+		WithTxRetryHook(func(attempt int, err error, delay time.Duration) {
+			retries = append(retries, attempt)
+		}),
+	})
+
+	err := retryTransaction(context.Background(), newEventLogger(nil, nil), o, func() error {
+		calls++
+		if calls < 3 {
+			return &pgconn.PgError{Code: "40001"}
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 2}, retries)
+}
+
+func TestRetryTransaction_StopsOnNonRetryableError(t *testing.T) {
+	calls := 0
+	fnErr := errors.New("constraint violated")
+
+	err := retryTransaction(context.Background(), newEventLogger(nil, nil), newTxRetryOptions(nil), func() error {
+		calls++
+		return fnErr
+	})
+
+	assert.Equal(t, fnErr, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryTransaction_GivesUpAfterMaxAttempts(t *testing.T) {
+	calls := 0
+
+	o := newTxRetryOptions([]TxRetryOption{
+		WithTxMaxAttempts(3),
+		WithTxBackoff(time.Millisecond, time.Millisecond),
+	})
+
+	err := retryTransaction(context.Background(), newEventLogger(nil, nil), o, func() error {
+		calls++
+		return &pgconn.PgError{Code: "40P01"}
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Contains(t, err.Error(), "after 3 attempts")
+	assert.True(t, IsSerializationFailure(err))
+}
+
+func TestRetryTransaction_RespectsContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+
+	o := newTxRetryOptions([]TxRetryOption{WithTxBackoff(time.Hour, time.Hour)})
+
+	err := retryTransaction(ctx, newEventLogger(nil, nil), o, func() error {
+		calls++
+		cancel()
+		return &pgconn.PgError{Code: "40001"}
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 1, calls)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,76 @@
+package pgxutils
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// txContextKey stores the active transaction in a context.
+type txContextKey struct{}
+
+// ContextWithTx returns a copy of ctx carrying tx.
+//
+// Transaction helpers given this context open a SAVEPOINT on tx instead of a
+// new transaction, and Connection.FromContext returns tx.
+func ContextWithTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
+
+// TxFromContext returns the transaction carried by ctx, if any.
+func TxFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(pgx.Tx)
+	return tx, ok && tx != nil
+}
+
+// FromContext returns the transaction carried by ctx, or the Connection when
+// ctx carries none.
+//
+// Example usage:
+//
+//	func (r *UserRepo) Create(ctx context.Context, name string) error {
+//	    _, err := r.conn.FromContext(ctx).Exec(ctx, "INSERT INTO users (name) VALUES ($1)", name)
+//	    return err
+//	}
+func (db *Connection) FromContext(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// beginContextTx opens a SAVEPOINT on the transaction carried by ctx, or a new
+// transaction with txOptions when there is none. Savepoints inherit the outer
+// transaction's options.
+func (db *Connection) beginContextTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.Begin(ctx)
+	}
+	return db.BeginTx(ctx, txOptions)
+}
+
+// WithTransactionContext runs fn in a transaction like WithTransaction, passing
+// fn a context that carries the transaction.
+//
+// Nested calls made with that context, including WithTransaction and
+// WithTransactionOptions, open a SAVEPOINT instead of a new transaction: an
+// error rolls back to the savepoint and leaves the outer transaction usable.
+//
+// Example usage:
+//
+//	err := pgxutils.WithTransactionContext(ctx, conn, logger, func(ctx context.Context, tx pgx.Tx) error {
+//	    if err := users.Create(ctx, "Alice"); err != nil {
+//	        return err
+//	    }
+//	    return audit.Record(ctx, "user_created") // may open its own nested transaction
+//	})
+func WithTransactionContext(ctx context.Context, conn *Connection, logger *slog.Logger, fn func(context.Context, pgx.Tx) error) error {
+	return runTransaction(ctx, conn, logger, pgx.TxOptions{}, fn)
+}
+
+// WithTransactionContext runs fn in a transaction, passing fn a context that
+// carries the transaction. See the package-level WithTransactionContext.
+func (db *Connection) WithTransactionContext(ctx context.Context, fn func(context.Context, pgx.Tx) error) error {
+	return WithTransactionContext(ctx, db, nil, fn)
+}
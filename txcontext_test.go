@@ -0,0 +1,70 @@
+package pgxutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTx is a pgx.Tx whose Begin returns a nested fakeTx and whose Commit
+// returns commitErr. Other methods panic.
+type fakeTx struct {
+	pgx.Tx
+	parent    *fakeTx
+	commitErr error
+}
+
+func (f *fakeTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{parent: f, commitErr: f.commitErr}, nil
+}
+
+func (f *fakeTx) Commit(ctx context.Context) error {
+	return f.commitErr
+}
+
+func TestTxFromContext(t *testing.T) {
+	_, ok := TxFromContext(context.Background())
+	assert.False(t, ok)
+
+	tx := &fakeTx{}
+	got, ok := TxFromContext(ContextWithTx(context.Background(), tx))
+	require.True(t, ok)
+	assert.Same(t, tx, got)
+
+	_, ok = TxFromContext(ContextWithTx(context.Background(), nil))
+	assert.False(t, ok)
+}
+
+func TestConnection_FromContext(t *testing.T) {
+	conn, err := NewConnection(baseConfig())
+	require.NoError(t, err)
+
+	assert.Same(t, conn, conn.FromContext(context.Background()))
+
+	tx := &fakeTx{}
+	assert.Same(t, tx, conn.FromContext(ContextWithTx(context.Background(), tx)))
+}
+
+func TestConnection_BeginContextTxOpensSavepoint(t *testing.T) {
+	conn, err := NewConnection(baseConfig())
+	require.NoError(t, err)
+
+	outer := &fakeTx{}
+	tx, err := conn.beginContextTx(ContextWithTx(context.Background(), outer), pgx.TxOptions{})
+	require.NoError(t, err)
+
+	nested, ok := tx.(*fakeTx)
+	require.True(t, ok)
+	assert.Same(t, outer, nested.parent)
+}
+
+func TestConnection_BeginContextTxWithoutPool(t *testing.T) {
+	conn, err := NewConnection(baseConfig())
+	require.NoError(t, err)
+
+	_, err = conn.beginContextTx(context.Background(), pgx.TxOptions{})
+	require.Error(t, err)
+}